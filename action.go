@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type action string
+
+const (
+	actionAcknowledge action = "acknowledge"
+	actionAdd         action = "add"
+	actionIgnore      action = "ignore"
+	actionRemove      action = "remove"
+)
+
+const (
+	notificationMediaApproved     = "MEDIA_APPROVED"
+	notificationMediaAutoApproved = "MEDIA_AUTO_APPROVED"
+	notificationMediaAvailable    = "MEDIA_AVAILABLE"
+	notificationMediaDeclined     = "MEDIA_DECLINED"
+	notificationMediaFailed       = "MEDIA_FAILED"
+	notificationMediaPending      = "MEDIA_PENDING"
+	notificationTest              = "TEST_NOTIFICATION"
+)
+
+// Default action for each overseerr, radarr and sonarr notification type, can be overridden with
+// WEBHOOK_ACTION_<TYPE>
+var notificationActions = map[string]action{
+	notificationMediaApproved:      actionAdd,
+	notificationMediaAutoApproved:  actionAdd,
+	notificationMediaAvailable:     actionAdd,
+	notificationMediaDeclined:      actionRemove,
+	notificationMediaFailed:        actionIgnore,
+	notificationMediaPending:       actionIgnore,
+	notificationRadarrDownload:     actionAdd,
+	notificationRadarrGrab:         actionIgnore,
+	notificationRadarrMovieAdded:   actionAdd,
+	notificationRadarrMovieDelete:  actionRemove,
+	notificationRadarrTest:         actionAcknowledge,
+	notificationSonarrDownload:     actionAdd,
+	notificationSonarrGrab:         actionIgnore,
+	notificationSonarrSeriesAdd:    actionAdd,
+	notificationSonarrSeriesDelete: actionRemove,
+	notificationSonarrTest:         actionAcknowledge,
+	notificationTest:               actionAcknowledge,
+}
+
+// Load action overrides from env
+func loadNotificationActions() error {
+	invalid := make([]string, 0)
+
+	for notificationType := range notificationActions {
+		value := strings.ToLower(strings.TrimSpace(os.Getenv("WEBHOOK_ACTION_" + notificationType)))
+		if value == "" {
+			continue
+		}
+
+		switch action(value) {
+		case actionAcknowledge, actionAdd, actionIgnore, actionRemove:
+			notificationActions[notificationType] = action(value)
+
+		default:
+			invalid = append(invalid, fmt.Sprintf("WEBHOOK_ACTION_%s=%s", notificationType, value))
+		}
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("one or more webhook actions are invalid, must be one of acknowledge, add, ignore or remove: %s", strings.Join(invalid, ", "))
+	}
+
+	return nil
+}
+
+// Get the action for a notification type, unknown types are ignored
+func notificationAction(notificationType string) action {
+	configured, ok := notificationActions[strings.ToUpper(notificationType)]
+	if !ok {
+		return actionIgnore
+	}
+
+	return configured
+}
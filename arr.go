@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sjdaws/overtrakt/notify"
+)
+
+const (
+	arrSourceRadarr = "radarr"
+	arrSourceSonarr = "sonarr"
+)
+
+const (
+	notificationRadarrDownload     = "RADARR_DOWNLOAD"
+	notificationRadarrGrab         = "RADARR_GRAB"
+	notificationRadarrMovieAdded   = "RADARR_MOVIE_ADDED"
+	notificationRadarrMovieDelete  = "RADARR_MOVIE_DELETE"
+	notificationRadarrTest         = "RADARR_TEST"
+	notificationSonarrDownload     = "SONARR_DOWNLOAD"
+	notificationSonarrGrab         = "SONARR_GRAB"
+	notificationSonarrSeriesAdd    = "SONARR_SERIES_ADD"
+	notificationSonarrSeriesDelete = "SONARR_SERIES_DELETE"
+	notificationSonarrTest         = "SONARR_TEST"
+)
+
+// Notification type for each event radarr and sonarr send, anything else is ignored
+var arrNotificationTypes = map[string]map[string]string{
+	arrSourceRadarr: {
+		"Download":    notificationRadarrDownload,
+		"Grab":        notificationRadarrGrab,
+		"MovieAdded":  notificationRadarrMovieAdded,
+		"MovieDelete": notificationRadarrMovieDelete,
+		"Test":        notificationRadarrTest,
+	},
+	arrSourceSonarr: {
+		"Download":     notificationSonarrDownload,
+		"Grab":         notificationSonarrGrab,
+		"SeriesAdd":    notificationSonarrSeriesAdd,
+		"SeriesDelete": notificationSonarrSeriesDelete,
+		"Test":         notificationSonarrTest,
+	},
+}
+
+type arrMedia struct {
+	ImdbId string `json:"imdbId"`
+	Title  string `json:"title"`
+	TmdbId int    `json:"tmdbId"`
+	TvdbId int    `json:"tvdbId"`
+	Year   int    `json:"year"`
+}
+
+type arrEpisode struct {
+	SeasonNumber int `json:"seasonNumber"`
+}
+
+type arrBody struct {
+	Episodes     []arrEpisode `json:"episodes"`
+	EventType    string       `json:"eventType"`
+	InstanceName string       `json:"instanceName"`
+	Movie        *arrMedia    `json:"movie"`
+	Series       *arrMedia    `json:"series"`
+}
+
+// Handle webhooks from radarr or sonarr, the payload is converted to the same format as overseerr so it goes
+// through the same queue and routing, add ?is4k=true to the url for instances which manage 4k media
+func arrWebhook(source string) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		defer closeRequestBody(request.Body)
+
+		payload, err := io.ReadAll(request.Body)
+		if err != nil {
+			log.Printf("webhook: %s: %v", source, err)
+			response.WriteHeader(400)
+			return
+		}
+
+		var arrRequest arrBody
+		err = json.Unmarshal(payload, &arrRequest)
+		if err != nil {
+			log.Printf("webhook: %s: %v", source, err)
+			notify.Message(fmt.Sprintf("Error reading %s webhook body: %v", source, err))
+			response.WriteHeader(400)
+			return
+		}
+
+		is4k, _ := strconv.ParseBool(request.URL.Query().Get("is4k"))
+
+		body := webhookBodyForArr(source, arrRequest, is4k)
+
+		payload, err = json.Marshal(body)
+		if err != nil {
+			log.Printf("webhook: %s: %v", source, err)
+			response.WriteHeader(500)
+			return
+		}
+
+		acceptWebhook(response, source, body, payload)
+	}
+}
+
+// Map a radarr or sonarr payload to the overseerr webhook which would have been sent for it, events without a
+// notification type have no action and are ignored
+func webhookBodyForArr(source string, arrRequest arrBody, is4k bool) webhookBody {
+	body := webhookBody{
+		Event:            arrRequest.EventType,
+		Extra:            make([]webhookExtra, 0),
+		NotificationType: arrNotificationTypes[source][arrRequest.EventType],
+		Request:          &overseerrRequest{Is4k: flexibleBool(is4k)},
+	}
+
+	item := arrRequest.Movie
+	body.Media.MediaType = mediaTypeMovie
+	if source == arrSourceSonarr {
+		item = arrRequest.Series
+		body.Media.MediaType = mediaTypeTvShow
+	}
+
+	if item == nil {
+		return body
+	}
+
+	body.Media.ImdbId = item.ImdbId
+	body.Media.TmdbId = strconv.Itoa(item.TmdbId)
+	body.Media.TvdbId = strconv.Itoa(item.TvdbId)
+
+	body.Subject = item.Title
+	if item.Year > 0 {
+		body.Subject = fmt.Sprintf("%s (%d)", item.Title, item.Year)
+	}
+
+	// Grabs and downloads are for episodes, only their seasons are requested
+	seasons := make([]string, 0)
+	seen := make(map[int]bool)
+	for _, episode := range arrRequest.Episodes {
+		if seen[episode.SeasonNumber] {
+			continue
+		}
+
+		seen[episode.SeasonNumber] = true
+		seasons = append(seasons, strconv.Itoa(episode.SeasonNumber))
+	}
+
+	if len(seasons) > 0 {
+		body.Extra = append(body.Extra, webhookExtra{Name: extraRequestedSeasons, Value: strings.Join(seasons, ", ")})
+	}
+
+	if arrRequest.InstanceName != "" {
+		body.Extra = append(body.Extra, webhookExtra{Name: "Instance", Value: arrRequest.InstanceName})
+	}
+
+	return body
+}
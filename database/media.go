@@ -0,0 +1,89 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Media struct {
+	MediaType string
+	TraktId   string
+	Slug      string
+	Title     string
+	Year      int
+	ImdbId    string
+	TmdbId    string
+	TvdbId    string
+	UpdatedAt time.Time
+}
+
+// Find cached media matching any of the supplied external ids, nil if nothing matches
+func (d *Database) FindMedia(mediaType string, imdbId string, tmdbId string, tvdbId string) (*Media, error) {
+	conditions := make([]string, 0)
+	args := []interface{}{mediaType}
+
+	if imdbId != "" {
+		conditions = append(conditions, "imdb_id = ?")
+		args = append(args, imdbId)
+	}
+
+	if tmdbId != "" {
+		conditions = append(conditions, "tmdb_id = ?")
+		args = append(args, tmdbId)
+	}
+
+	if tvdbId != "" {
+		conditions = append(conditions, "tvdb_id = ?")
+		args = append(args, tvdbId)
+	}
+
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf("SELECT media_type, trakt_id, slug, title, year, imdb_id, tmdb_id, tvdb_id, updated_at FROM media WHERE media_type = ? AND (%s) LIMIT 1", strings.Join(conditions, " OR "))
+
+	media := &Media{}
+	err := d.connection.QueryRow(query, args...).Scan(&media.MediaType, &media.TraktId, &media.Slug, &media.Title, &media.Year, &media.ImdbId, &media.TmdbId, &media.TvdbId, &media.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
+
+func (d *Database) SaveMedia(media *Media) error {
+	prepared, err := d.connection.Prepare("INSERT INTO media (media_type, trakt_id, slug, title, year, imdb_id, tmdb_id, tvdb_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE slug = ?, title = ?, year = ?, imdb_id = ?, tmdb_id = ?, tvdb_id = ?")
+	if err != nil {
+		return err
+	}
+
+	stmt := &statement{
+		prepared: prepared,
+	}
+	defer stmt.close()
+
+	_, err = stmt.prepared.Exec(
+		media.MediaType,
+		media.TraktId,
+		media.Slug,
+		media.Title,
+		media.Year,
+		media.ImdbId,
+		media.TmdbId,
+		media.TvdbId,
+		media.Slug,
+		media.Title,
+		media.Year,
+		media.ImdbId,
+		media.TmdbId,
+		media.TvdbId,
+	)
+
+	return err
+}
@@ -11,7 +11,7 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
-const targetVersion = 2
+const targetVersion = 15
 
 // Create a new database
 func (d *Database) create(dbname string) error {
@@ -67,6 +67,10 @@ func (d *Database) Close() {
 	}
 }
 
+func (d *Database) Health() bool {
+	return d.connection.Ping() == nil
+}
+
 func (s *statement) close() {
 	err := s.prepared.Close()
 	if err != nil {
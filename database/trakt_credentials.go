@@ -6,14 +6,33 @@ import (
 
 type TraktCredentials struct {
 	ClientId     string
+	Account      string
 	AccessToken  string
 	RefreshToken string
 	TokenType    string
+	CreatedAt    time.Time
 	ExpiresAt    time.Time
 }
 
-func (d *Database) GetTraktAuth(clientId string) (*TraktCredentials, error) {
-	prepared, err := d.connection.Prepare("SELECT client_id, access_token, expires_at, refresh_token, token_type FROM trakt_credentials WHERE client_id = ?")
+// Assign credentials created before accounts existed to an account
+func (d *Database) AdoptTraktAuth(clientId string, account string) error {
+	prepared, err := d.connection.Prepare("UPDATE IGNORE trakt_credentials SET account = ? WHERE client_id = ? AND account = ''")
+	if err != nil {
+		return err
+	}
+
+	stmt := &statement{
+		prepared: prepared,
+	}
+	defer stmt.close()
+
+	_, err = stmt.prepared.Exec(account, clientId)
+
+	return err
+}
+
+func (d *Database) GetTraktAuth(clientId string, account string) (*TraktCredentials, error) {
+	prepared, err := d.connection.Prepare("SELECT client_id, account, access_token, created_at, expires_at, refresh_token, token_type FROM trakt_credentials WHERE client_id = ? AND account = ?")
 	if err != nil {
 		return nil, err
 	}
@@ -24,7 +43,7 @@ func (d *Database) GetTraktAuth(clientId string) (*TraktCredentials, error) {
 	defer stmt.close()
 
 	credentials := &TraktCredentials{}
-	err = stmt.prepared.QueryRow(clientId).Scan(&credentials.ClientId, &credentials.AccessToken, &credentials.ExpiresAt, &credentials.RefreshToken, &credentials.TokenType)
+	err = stmt.prepared.QueryRow(clientId, account).Scan(&credentials.ClientId, &credentials.Account, &credentials.AccessToken, &credentials.CreatedAt, &credentials.ExpiresAt, &credentials.RefreshToken, &credentials.TokenType)
 	if err != nil {
 		return nil, err
 	}
@@ -33,7 +52,7 @@ func (d *Database) GetTraktAuth(clientId string) (*TraktCredentials, error) {
 }
 
 func (d *Database) SetTraktAuth(credentials *TraktCredentials) error {
-	prepared, err := d.connection.Prepare("INSERT INTO trakt_credentials VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE access_token = ?, refresh_token = ?, token_type = ?, expires_at = ?")
+	prepared, err := d.connection.Prepare("INSERT INTO trakt_credentials (client_id, account, access_token, refresh_token, token_type, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE access_token = ?, refresh_token = ?, token_type = ?, created_at = ?, expires_at = ?")
 	if err != nil {
 		return err
 	}
@@ -45,13 +64,16 @@ func (d *Database) SetTraktAuth(credentials *TraktCredentials) error {
 
 	_, err = stmt.prepared.Exec(
 		credentials.ClientId,
+		credentials.Account,
 		credentials.AccessToken,
 		credentials.RefreshToken,
 		credentials.TokenType,
+		credentials.CreatedAt,
 		credentials.ExpiresAt,
 		credentials.AccessToken,
 		credentials.RefreshToken,
 		credentials.TokenType,
+		credentials.CreatedAt,
 		credentials.ExpiresAt,
 	)
 
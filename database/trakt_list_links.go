@@ -0,0 +1,109 @@
+package database
+
+import (
+	"database/sql"
+)
+
+const (
+	ListLinkStatusExisting  = "existing"
+	ListLinkStatusFailed    = "failed"
+	ListLinkStatusRequested = "requested"
+)
+
+// ListLink records that an item on a trakt list has been handled so it's never requested in overseerr twice
+type ListLink struct {
+	Account            string
+	ListId             string
+	MediaType          string
+	TraktId            string
+	ImdbId             string
+	TmdbId             string
+	TvdbId             string
+	OverseerrRequestId string
+	Status             string
+	LastError          string
+}
+
+// Get every link for a list
+func (d *Database) GetListLinks(account string, listId string) ([]*ListLink, error) {
+	results, err := d.connection.Query("SELECT account, list_id, media_type, trakt_id, imdb_id, tmdb_id, tvdb_id, overseerr_request_id, status, last_error FROM trakt_list_links WHERE account = ? AND list_id = ?", account, listId)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var links []*ListLink
+	for results.Next() {
+		var link ListLink
+		err = results.Scan(&link.Account, &link.ListId, &link.MediaType, &link.TraktId, &link.ImdbId, &link.TmdbId, &link.TvdbId, &link.OverseerrRequestId, &link.Status, &link.LastError)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, &link)
+	}
+
+	return links, results.Err()
+}
+
+// Find the link for an overseerr request the poller made, nil if the request didn't come from a list
+func (d *Database) FindRequestedListLink(overseerrRequestId string) (*ListLink, error) {
+	if overseerrRequestId == "" {
+		return nil, nil
+	}
+
+	prepared, err := d.connection.Prepare("SELECT account, list_id, media_type, trakt_id, imdb_id, tmdb_id, tvdb_id, overseerr_request_id, status, last_error FROM trakt_list_links WHERE overseerr_request_id = ? AND status = ? LIMIT 1")
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &statement{
+		prepared: prepared,
+	}
+	defer stmt.close()
+
+	var link ListLink
+	err = stmt.prepared.QueryRow(overseerrRequestId, ListLinkStatusRequested).Scan(&link.Account, &link.ListId, &link.MediaType, &link.TraktId, &link.ImdbId, &link.TmdbId, &link.TvdbId, &link.OverseerrRequestId, &link.Status, &link.LastError)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+func (d *Database) SaveListLink(link *ListLink) error {
+	prepared, err := d.connection.Prepare("INSERT INTO trakt_list_links (account, list_id, media_type, trakt_id, imdb_id, tmdb_id, tvdb_id, overseerr_request_id, status, last_error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE overseerr_request_id = ?, status = ?, last_error = ?")
+	if err != nil {
+		return err
+	}
+
+	stmt := &statement{
+		prepared: prepared,
+	}
+	defer stmt.close()
+
+	lastError := link.LastError
+	if len(lastError) > 1024 {
+		lastError = lastError[:1024]
+	}
+
+	_, err = stmt.prepared.Exec(
+		link.Account,
+		link.ListId,
+		link.MediaType,
+		link.TraktId,
+		link.ImdbId,
+		link.TmdbId,
+		link.TvdbId,
+		link.OverseerrRequestId,
+		link.Status,
+		lastError,
+		link.OverseerrRequestId,
+		link.Status,
+		lastError,
+	)
+
+	return err
+}
@@ -1,20 +1,61 @@
 package database
 
 import (
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/sjdaws/overtrakt/ids"
+)
+
+const (
+	RequestStatusFailed   = "failed"
+	RequestStatusIgnored  = "ignored"
+	RequestStatusNotFound = "not_found"
+	RequestStatusPending  = "pending"
+	RequestStatusRemoved  = "removed"
+	RequestStatusSynced   = "synced"
+	RequestStatusWatched  = "watched"
 )
 
 type TraktRequest struct {
-	ImdbId      string
-	RequestType string
-	TmdbId      string
-	TvdbId      string
-	Added       bool
-	CreatedAt   time.Time
+	ImdbId           string
+	RequestType      string
+	TmdbId           string
+	TvdbId           string
+	Requester        string
+	RequestId        string
+	RequesterMail    string
+	Subject          string
+	Message          string
+	Image            string
+	Is4k             bool
+	Seasons          []int
+	Extra            string
+	NotificationType string
+	Status           string
+	Attempts         int
+	LastError        string
+	LastAttemptAt    time.Time
+	SyncedAt         time.Time
+	CreatedAt        time.Time
 }
 
+const traktRequestColumns = "imdb_id, request_type, tmdb_id, tvdb_id, requester, overseerr_request_id, requester_email, subject, COALESCE(message, ''), image, is_4k, seasons, COALESCE(extra, ''), notification_type, status, attempts, last_error, last_attempt_at, synced_at, created_at"
+
 func (d *Database) AddTraktRequest(request *TraktRequest) error {
-	prepared, err := d.connection.Prepare("INSERT INTO trakt_requests VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE imdb_id = ?, request_type = ?, tmdb_id = ?, tvdb_id = ?")
+	err := d.normaliseRequestKey(request)
+	if err != nil {
+		return err
+	}
+
+	// Requesting again resets anything which hasn't been synced or has new seasons. Watched requests stay watched
+	// unless this is a new overseerr request, removed requests are deliberately not kept as requesting again after
+	// a removal is an explicit request to add it back. Attempts and status are updated first as they depend on the
+	// previous values
+	prepared, err := d.connection.Prepare("INSERT INTO trakt_requests (imdb_id, request_type, tmdb_id, tvdb_id, requester, overseerr_request_id, requester_email, subject, message, image, is_4k, seasons, extra, notification_type, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE attempts = IF((status = ? AND overseerr_request_id = VALUES(overseerr_request_id)) OR (status = ? AND seasons = VALUES(seasons)), attempts, 0), status = IF((status = ? AND overseerr_request_id = VALUES(overseerr_request_id)) OR (status = ? AND seasons = VALUES(seasons)), status, ?), overseerr_request_id = VALUES(overseerr_request_id), requester_email = VALUES(requester_email), subject = VALUES(subject), message = VALUES(message), image = VALUES(image), seasons = VALUES(seasons), extra = VALUES(extra), notification_type = VALUES(notification_type)")
 	if err != nil {
 		return err
 	}
@@ -29,38 +70,144 @@ func (d *Database) AddTraktRequest(request *TraktRequest) error {
 		request.RequestType,
 		request.TmdbId,
 		request.TvdbId,
-		false,
-		nil,
+		request.Requester,
+		request.RequestId,
+		request.RequesterMail,
+		request.Subject,
+		request.Message,
+		request.Image,
+		request.Is4k,
+		formatSeasons(request.Seasons),
+		request.Extra,
+		request.NotificationType,
+		RequestStatusPending,
+		RequestStatusWatched,
+		RequestStatusSynced,
+		RequestStatusWatched,
+		RequestStatusSynced,
+		RequestStatusPending,
+	)
+
+	return err
+}
+
+// Store a request with its status unless it's already stored, returns false if it was already stored
+func (d *Database) InsertTraktRequest(request *TraktRequest) (bool, error) {
+	err := d.normaliseRequestKey(request)
+	if err != nil {
+		return false, err
+	}
+
+	if request.Status == "" {
+		request.Status = RequestStatusPending
+	}
+
+	prepared, err := d.connection.Prepare("INSERT IGNORE INTO trakt_requests (imdb_id, request_type, tmdb_id, tvdb_id, requester, overseerr_request_id, requester_email, subject, message, image, is_4k, seasons, extra, notification_type, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return false, err
+	}
+
+	stmt := &statement{
+		prepared: prepared,
+	}
+	defer stmt.close()
+
+	result, err := stmt.prepared.Exec(
 		request.ImdbId,
 		request.RequestType,
 		request.TmdbId,
 		request.TvdbId,
+		request.Requester,
+		request.RequestId,
+		request.RequesterMail,
+		request.Subject,
+		request.Message,
+		request.Image,
+		request.Is4k,
+		formatSeasons(request.Seasons),
+		request.Extra,
+		request.NotificationType,
+		request.Status,
 	)
+	if err != nil {
+		return false, err
+	}
 
-	return err
+	inserted, err := result.RowsAffected()
+
+	return inserted > 0, err
 }
 
-func (d *Database) GetUnsyncedReleases() ([]*TraktRequest, error) {
-	results, err := d.connection.Query("SELECT * FROM trakt_requests WHERE added = 0;")
+// Find the stored request for the same media and requester, returns nil if it hasn't been requested before
+func (d *Database) FindTraktRequest(request *TraktRequest) (*TraktRequest, error) {
+	lookup := *request
+	err := d.normaliseRequestKey(&lookup)
 	if err != nil {
 		return nil, err
 	}
 
-	var requests []*TraktRequest
-	for results.Next() {
-		var request TraktRequest
-		err = results.Scan(&request.ImdbId, &request.RequestType, &request.TmdbId, &request.TvdbId, &request.Added, &request.CreatedAt)
-		if err != nil {
-			return nil, err
-		}
-		requests = append(requests, &request)
+	requests, err := d.queryTraktRequests("SELECT "+traktRequestColumns+" FROM trakt_requests WHERE imdb_id = ? AND request_type = ? AND tmdb_id = ? AND tvdb_id = ? AND requester = ? AND is_4k = ?", lookup.ImdbId, lookup.RequestType, lookup.TmdbId, lookup.TvdbId, lookup.Requester, lookup.Is4k)
+	if err != nil || len(requests) == 0 {
+		return nil, err
+	}
+
+	return requests[0], nil
+}
+
+// Find requests from any requester for media matching any of the supplied external ids
+func (d *Database) FindTraktRequestsForMedia(requestType string, imdbId string, tmdbId string, tvdbId string) ([]*TraktRequest, error) {
+	conditions := make([]string, 0)
+	args := []interface{}{requestType}
+
+	if imdbId != "" {
+		conditions = append(conditions, "imdb_id = ?")
+		args = append(args, imdbId)
+	}
+
+	if tmdbId != "" {
+		conditions = append(conditions, "tmdb_id = ?")
+		args = append(args, tmdbId)
+	}
+
+	if tvdbId != "" {
+		conditions = append(conditions, "tvdb_id = ?")
+		args = append(args, tvdbId)
+	}
+
+	if len(conditions) == 0 {
+		return nil, nil
 	}
 
-	return requests, nil
+	return d.queryTraktRequests("SELECT "+traktRequestColumns+" FROM trakt_requests WHERE request_type = ? AND ("+strings.Join(conditions, " OR ")+")", args...)
+}
+
+// Get requests which have failed too many times to be retried
+func (d *Database) GetDeadLetteredRequests(maxAttempts int) ([]*TraktRequest, error) {
+	return d.queryTraktRequests("SELECT "+traktRequestColumns+" FROM trakt_requests WHERE status IN (?, ?) AND attempts >= ? ORDER BY last_attempt_at", RequestStatusFailed, RequestStatusNotFound, maxAttempts)
+}
+
+// Get requests which are on trakt
+func (d *Database) GetSyncedRequests() ([]*TraktRequest, error) {
+	return d.queryTraktRequests("SELECT "+traktRequestColumns+" FROM trakt_requests WHERE status = ? ORDER BY synced_at", RequestStatusSynced)
+}
+
+// Get every request regardless of status
+func (d *Database) GetTraktRequests() ([]*TraktRequest, error) {
+	return d.queryTraktRequests("SELECT " + traktRequestColumns + " FROM trakt_requests ORDER BY created_at")
 }
 
+func (d *Database) GetUnsyncedReleases(maxAttempts int) ([]*TraktRequest, error) {
+	return d.queryTraktRequests("SELECT "+traktRequestColumns+" FROM trakt_requests WHERE status IN (?, ?, ?) AND attempts < ?", RequestStatusPending, RequestStatusFailed, RequestStatusNotFound, maxAttempts)
+}
+
+// Record the outcome of an attempt to update trakt
 func (d *Database) UpdateTraktRequest(request *TraktRequest) error {
-	prepared, err := d.connection.Prepare("INSERT INTO trakt_requests VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE imdb_id = ?, request_type = ?, tmdb_id = ?, tvdb_id = ?, added = ?")
+	err := d.normaliseRequestKey(request)
+	if err != nil {
+		return err
+	}
+
+	prepared, err := d.connection.Prepare("INSERT INTO trakt_requests (imdb_id, request_type, tmdb_id, tvdb_id, requester, is_4k, status, attempts, last_error, last_attempt_at, synced_at) VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?) ON DUPLICATE KEY UPDATE status = ?, attempts = attempts + 1, last_error = ?, last_attempt_at = ?, synced_at = COALESCE(?, synced_at)")
 	if err != nil {
 		return err
 	}
@@ -70,19 +217,234 @@ func (d *Database) UpdateTraktRequest(request *TraktRequest) error {
 	}
 	defer stmt.close()
 
+	now := time.Now()
+
+	lastError := request.LastError
+	if len(lastError) > 1024 {
+		lastError = lastError[:1024]
+	}
+
+	var syncedAt sql.NullTime
+	if request.Status == RequestStatusSynced {
+		syncedAt = sql.NullTime{Time: now, Valid: true}
+	}
+
 	_, err = stmt.prepared.Exec(
 		request.ImdbId,
 		request.RequestType,
 		request.TmdbId,
 		request.TvdbId,
-		request.Added,
-		nil,
+		request.Requester,
+		request.Is4k,
+		request.Status,
+		lastError,
+		now,
+		syncedAt,
+		request.Status,
+		lastError,
+		now,
+		syncedAt,
+	)
+
+	return err
+}
+
+// Mark a request as pending again so it is retried from scratch
+func (d *Database) ResetTraktRequest(request *TraktRequest) error {
+	err := d.normaliseRequestKey(request)
+	if err != nil {
+		return err
+	}
+
+	prepared, err := d.connection.Prepare("UPDATE trakt_requests SET status = ?, attempts = 0, last_error = '' WHERE imdb_id = ? AND request_type = ? AND tmdb_id = ? AND tvdb_id = ? AND requester = ? AND is_4k = ?")
+	if err != nil {
+		return err
+	}
+
+	stmt := &statement{
+		prepared: prepared,
+	}
+	defer stmt.close()
+
+	_, err = stmt.prepared.Exec(
+		RequestStatusPending,
 		request.ImdbId,
 		request.RequestType,
 		request.TmdbId,
 		request.TvdbId,
-		request.Added,
+		request.Requester,
+		request.Is4k,
 	)
+	if err == nil {
+		request.Status = RequestStatusPending
+		request.Attempts = 0
+		request.LastError = ""
+	}
 
 	return err
 }
+
+// Replace the seasons of a stored request without changing its status
+func (d *Database) SetTraktRequestSeasons(request *TraktRequest, seasons []int) error {
+	err := d.normaliseRequestKey(request)
+	if err != nil {
+		return err
+	}
+
+	prepared, err := d.connection.Prepare("UPDATE trakt_requests SET seasons = ? WHERE imdb_id = ? AND request_type = ? AND tmdb_id = ? AND tvdb_id = ? AND requester = ? AND is_4k = ?")
+	if err != nil {
+		return err
+	}
+
+	stmt := &statement{
+		prepared: prepared,
+	}
+	defer stmt.close()
+
+	_, err = stmt.prepared.Exec(
+		formatSeasons(seasons),
+		request.ImdbId,
+		request.RequestType,
+		request.TmdbId,
+		request.TvdbId,
+		request.Requester,
+		request.Is4k,
+	)
+
+	return err
+}
+
+// Normalise ids and adopt any row stored before imdb ids were kept, so the same title always maps to the same row
+func (d *Database) normaliseRequestKey(request *TraktRequest) error {
+	err := normaliseRequestIds(request)
+	if err != nil {
+		return err
+	}
+
+	return d.adoptLegacyRequest(request)
+}
+
+// Rows stored before imdb ids were normalised have an empty imdb id, give them this request's imdb id so they are
+// matched by the other ids rather than orphaned, nothing is changed if a row with the imdb id already exists
+func (d *Database) adoptLegacyRequest(request *TraktRequest) error {
+	if request.ImdbId == "" || (request.TmdbId == "" && request.TvdbId == "") {
+		return nil
+	}
+
+	prepared, err := d.connection.Prepare("UPDATE IGNORE trakt_requests SET imdb_id = ? WHERE imdb_id = '' AND request_type = ? AND tmdb_id = ? AND tvdb_id = ? AND requester = ? AND is_4k = ?")
+	if err != nil {
+		return err
+	}
+
+	stmt := &statement{
+		prepared: prepared,
+	}
+	defer stmt.close()
+
+	_, err = stmt.prepared.Exec(
+		request.ImdbId,
+		request.RequestType,
+		request.TmdbId,
+		request.TvdbId,
+		request.Requester,
+		request.Is4k,
+	)
+
+	return err
+}
+
+// Normalise ids so the same title always maps to the same row
+func normaliseRequestIds(request *TraktRequest) error {
+	var err error
+	request.ImdbId, err = ids.Imdb(request.ImdbId)
+	if err != nil {
+		return err
+	}
+
+	request.TmdbId, err = ids.Tmdb(request.TmdbId)
+	if err != nil {
+		return err
+	}
+
+	request.TvdbId, err = ids.Tvdb(request.TvdbId)
+
+	return err
+}
+
+func (d *Database) queryTraktRequests(query string, args ...interface{}) ([]*TraktRequest, error) {
+	results, err := d.connection.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var requests []*TraktRequest
+	for results.Next() {
+		var request TraktRequest
+		var lastAttemptAt sql.NullTime
+		var seasons string
+		var syncedAt sql.NullTime
+		err = results.Scan(&request.ImdbId, &request.RequestType, &request.TmdbId, &request.TvdbId, &request.Requester, &request.RequestId, &request.RequesterMail, &request.Subject, &request.Message, &request.Image, &request.Is4k, &seasons, &request.Extra, &request.NotificationType, &request.Status, &request.Attempts, &request.LastError, &lastAttemptAt, &syncedAt, &request.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		request.LastAttemptAt = lastAttemptAt.Time
+		request.Seasons = ParseSeasons(seasons)
+		request.SyncedAt = syncedAt.Time
+		requests = append(requests, &request)
+	}
+
+	return requests, results.Err()
+}
+
+// Seasons are stored as a sorted comma separated list so the same seasons always compare equal
+func formatSeasons(seasons []int) string {
+	sorted := append([]int(nil), seasons...)
+	sort.Ints(sorted)
+
+	values := make([]string, 0, len(sorted))
+	for i, season := range sorted {
+		if i > 0 && season == sorted[i-1] {
+			continue
+		}
+		values = append(values, strconv.Itoa(season))
+	}
+
+	return strings.Join(values, ",")
+}
+
+// CombineSeasons joins the seasons of two requests for the same show, sorted and without duplicates. No seasons means
+// the whole show so combining with it is the whole show
+func CombineSeasons(existing []int, requested []int) []int {
+	if len(existing) == 0 || len(requested) == 0 {
+		return make([]int, 0)
+	}
+
+	seen := make(map[int]bool)
+	seasons := make([]int, 0, len(existing)+len(requested))
+	for _, season := range append(append([]int(nil), existing...), requested...) {
+		if seen[season] {
+			continue
+		}
+
+		seen[season] = true
+		seasons = append(seasons, season)
+	}
+
+	sort.Ints(seasons)
+
+	return seasons
+}
+
+// ParseSeasons reads a list of seasons such as "1, 2, 3", anything which isn't a season number is ignored
+func ParseSeasons(value string) []int {
+	seasons := make([]int, 0)
+	for _, part := range strings.Split(value, ",") {
+		season, err := strconv.Atoi(strings.TrimSpace(part))
+		if err == nil && season >= 0 {
+			seasons = append(seasons, season)
+		}
+	}
+
+	return seasons
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"time"
+)
+
+const (
+	WebhookStatusDone       = "done"
+	WebhookStatusFailed     = "failed"
+	WebhookStatusPending    = "pending"
+	WebhookStatusProcessing = "processing"
+)
+
+type QueuedWebhook struct {
+	Id            int64
+	Payload       string
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+}
+
+// Claim webhooks which are due and mark them as processing so they aren't claimed twice
+func (d *Database) ClaimDueWebhooks(limit int) ([]*QueuedWebhook, error) {
+	transaction, err := d.connection.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := transaction.Query("SELECT id, payload, status, attempts, last_error, next_attempt_at, created_at FROM webhook_queue WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT ? FOR UPDATE", WebhookStatusPending, time.Now(), limit)
+	if err != nil {
+		_ = transaction.Rollback()
+		return nil, err
+	}
+
+	webhooks := make([]*QueuedWebhook, 0)
+	for results.Next() {
+		var webhook QueuedWebhook
+		err = results.Scan(&webhook.Id, &webhook.Payload, &webhook.Status, &webhook.Attempts, &webhook.LastError, &webhook.NextAttemptAt, &webhook.CreatedAt)
+		if err != nil {
+			_ = results.Close()
+			_ = transaction.Rollback()
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	_ = results.Close()
+
+	for _, webhook := range webhooks {
+		_, err = transaction.Exec("UPDATE webhook_queue SET status = ? WHERE id = ?", WebhookStatusProcessing, webhook.Id)
+		if err != nil {
+			_ = transaction.Rollback()
+			return nil, err
+		}
+		webhook.Status = WebhookStatusProcessing
+	}
+
+	return webhooks, transaction.Commit()
+}
+
+func (d *Database) EnqueueWebhook(payload string) (int64, error) {
+	prepared, err := d.connection.Prepare("INSERT INTO webhook_queue (payload, status, next_attempt_at) VALUES (?, ?, ?)")
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := &statement{
+		prepared: prepared,
+	}
+	defer stmt.close()
+
+	result, err := stmt.prepared.Exec(payload, WebhookStatusPending, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// Return webhooks left processing by a previous run to the queue
+func (d *Database) ResetProcessingWebhooks() error {
+	_, err := d.connection.Exec("UPDATE webhook_queue SET status = ? WHERE status = ?", WebhookStatusPending, WebhookStatusProcessing)
+
+	return err
+}
+
+func (d *Database) UpdateWebhook(webhook *QueuedWebhook) error {
+	prepared, err := d.connection.Prepare("UPDATE webhook_queue SET status = ?, attempts = ?, last_error = ?, next_attempt_at = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+
+	stmt := &statement{
+		prepared: prepared,
+	}
+	defer stmt.close()
+
+	lastError := webhook.LastError
+	if len(lastError) > 1024 {
+		lastError = lastError[:1024]
+	}
+
+	_, err = stmt.prepared.Exec(webhook.Status, webhook.Attempts, lastError, webhook.NextAttemptAt, webhook.Id)
+
+	return err
+}
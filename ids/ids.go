@@ -0,0 +1,64 @@
+package ids
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var imdbPattern = regexp.MustCompile(`^(tt)?([0-9]+)$`)
+
+// Imdb validates an imdb id and normalises it to tt followed by at least 7 digits, empty means no id
+func Imdb(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" || value == "0" {
+		return "", nil
+	}
+
+	matches := imdbPattern.FindStringSubmatch(value)
+	if matches == nil {
+		return "", fmt.Errorf("invalid imdb id %q, expected tt followed by digits", value)
+	}
+
+	number, err := strconv.ParseUint(matches[2], 10, 64)
+	if err != nil || number == 0 {
+		return "", fmt.Errorf("invalid imdb id %q, expected tt followed by digits", value)
+	}
+
+	return fmt.Sprintf("tt%07d", number), nil
+}
+
+// Tmdb validates a tmdb id, empty means no id
+func Tmdb(value string) (string, error) {
+	return numeric("tmdb", value)
+}
+
+// Trakt validates a trakt id, empty means no id
+func Trakt(value string) (string, error) {
+	return numeric("trakt", value)
+}
+
+// Tvdb validates a tvdb id, empty means no id
+func Tvdb(value string) (string, error) {
+	return numeric("tvdb", value)
+}
+
+// Validate a positive integer id, zero is treated as no id
+func numeric(name string, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+
+	number, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s id %q, expected a number", name, value)
+	}
+
+	if number == 0 {
+		return "", nil
+	}
+
+	return strconv.FormatUint(number, 10), nil
+}
@@ -0,0 +1,92 @@
+package ids
+
+import (
+	"testing"
+)
+
+func TestImdb(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: ""},
+		{value: "0", want: ""},
+		{value: "  ", want: ""},
+		{value: "tt0111161", want: "tt0111161"},
+		{value: "TT0111161", want: "tt0111161"},
+		{value: " tt0111161 ", want: "tt0111161"},
+		{value: "111161", want: "tt0111161"},
+		{value: "tt111161", want: "tt0111161"},
+		{value: "tt10872600", want: "tt10872600"},
+		{value: "tt0", wantErr: true},
+		{value: "tt", wantErr: true},
+		{value: "nm0000209", wantErr: true},
+		{value: "tt01a", wantErr: true},
+		{value: "-1", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := Imdb(test.value)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("Imdb(%q) = %q, expected an error", test.value, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Imdb(%q) returned error: %v", test.value, err)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("Imdb(%q) = %q, expected %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestNumeric(t *testing.T) {
+	validators := map[string]func(string) (string, error){
+		"tmdb":  Tmdb,
+		"trakt": Trakt,
+		"tvdb":  Tvdb,
+	}
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: ""},
+		{value: "0", want: ""},
+		{value: "000", want: ""},
+		{value: "278", want: "278"},
+		{value: " 278 ", want: "278"},
+		{value: "00278", want: "278"},
+		{value: "-278", wantErr: true},
+		{value: "27.8", wantErr: true},
+		{value: "tt0111161", wantErr: true},
+	}
+
+	for name, validate := range validators {
+		for _, test := range tests {
+			got, err := validate(test.value)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("%s(%q) = %q, expected an error", name, test.value, got)
+				}
+				continue
+			}
+
+			if err != nil {
+				t.Errorf("%s(%q) returned error: %v", name, test.value, err)
+				continue
+			}
+
+			if got != test.want {
+				t.Errorf("%s(%q) = %q, expected %q", name, test.value, got, test.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	db "github.com/sjdaws/overtrakt/database"
+	"github.com/sjdaws/overtrakt/ids"
+	"github.com/sjdaws/overtrakt/notify"
+	"github.com/sjdaws/overtrakt/overseerr"
+	"github.com/sjdaws/overtrakt/trakt"
+)
+
+var (
+	requestLists []requestList
+
+	traktRequestInterval = os.Getenv("TRAKT_REQUEST_INTERVAL")
+	traktRequestLists    = os.Getenv("TRAKT_REQUEST_LISTS")
+)
+
+// A trakt list whose items are requested in overseerr on behalf of a user
+type requestList struct {
+	account         string
+	listId          string
+	overseerrUserId int
+}
+
+// Polls trakt lists and requests anything new in overseerr while the server is running
+type listPoller struct {
+	done      chan struct{}
+	interval  time.Duration
+	overseerr *overseerr.Client
+}
+
+var poller *listPoller
+
+// Held while a request is created and its link saved, webhooks for the request wait on it so they always find the link
+var listLinkMutex sync.Mutex
+
+// Load the lists to request from env, entries are space separated in the format
+// trakt_user:list:overseerr_user_id
+func loadRequestLists() error {
+	for _, entry := range strings.Fields(traktRequestLists) {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid TRAKT_REQUEST_LISTS entry %s, expected trakt_user:list:overseerr_user_id", entry)
+		}
+
+		userId, err := strconv.Atoi(parts[2])
+		if err != nil || userId < 1 {
+			return fmt.Errorf("invalid TRAKT_REQUEST_LISTS entry %s, overseerr user id must be a positive number", entry)
+		}
+
+		requestLists = append(requestLists, requestList{
+			account:         parts[0],
+			listId:          parts[1],
+			overseerrUserId: userId,
+		})
+	}
+
+	return nil
+}
+
+func newListPoller() (*listPoller, error) {
+	poller := &listPoller{
+		done: make(chan struct{}),
+	}
+
+	if len(requestLists) == 0 {
+		return poller, nil
+	}
+
+	interval := traktRequestInterval
+	if interval == "" {
+		interval = "15m"
+	}
+
+	var err error
+	poller.interval, err = time.ParseDuration(interval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRAKT_REQUEST_INTERVAL: %v", err)
+	}
+
+	poller.overseerr, err = newOverseerrClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return poller, nil
+}
+
+// Run until the context is cancelled, the poller is disabled if there are no lists or the interval is zero
+func (p *listPoller) run(ctx context.Context) {
+	defer close(p.done)
+
+	if len(requestLists) == 0 || p.interval <= 0 {
+		return
+	}
+
+	log.Printf("poller: requesting new items from %d trakt list(s) every %s", len(requestLists), p.interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.interval):
+		}
+
+		p.poll()
+	}
+}
+
+// Wait for an in progress run to finish
+func (p *listPoller) wait() {
+	<-p.done
+}
+
+// Request new items from every list, returns false if any list couldn't be polled
+func (p *listPoller) poll() bool {
+	success := true
+	for _, list := range requestLists {
+		if clients.NeedsAuthorisation(list.account) {
+			log.Printf("poller: skipping %s list %s, trakt account %s is not authorised", list.account, list.listId, list.account)
+			success = false
+			continue
+		}
+
+		err := p.pollList(list)
+		if err != nil {
+			log.Printf("poller: %s list %s: %v", list.account, list.listId, err)
+			success = false
+		}
+	}
+
+	return success
+}
+
+func (p *listPoller) pollList(list requestList) error {
+	items, err := clients.ListItems(trakt.NewListTarget(list.account, list.listId))
+	if err != nil {
+		return err
+	}
+
+	links, err := database.GetListLinks(list.account, list.listId)
+	if err != nil {
+		return err
+	}
+
+	linked := make(map[string]bool)
+	for _, link := range links {
+		linked[link.MediaType+":"+link.TraktId] = true
+	}
+
+	for _, item := range items {
+		if linked[item.MediaType+":"+item.TraktId] {
+			continue
+		}
+
+		// Ids from trakt are trusted, anything invalid is treated as missing
+		imdbId, _ := ids.Imdb(item.ImdbId)
+		tmdbId, _ := ids.Tmdb(item.TmdbId)
+		tvdbId, _ := ids.Tvdb(item.TvdbId)
+
+		link := &db.ListLink{
+			Account:   list.account,
+			ListId:    list.listId,
+			MediaType: item.MediaType,
+			TraktId:   item.TraktId,
+			ImdbId:    imdbId,
+			TmdbId:    tmdbId,
+			TvdbId:    tvdbId,
+		}
+
+		err = p.requestAndLink(list, item, link)
+		if err != nil {
+			// Nothing is recorded so the item is tried again next time
+			log.Printf("poller: unable to request %s %s: %v", item.MediaType, item.Title, err)
+		}
+	}
+
+	return nil
+}
+
+// Request an item and save its link before any webhook overseerr sends for the request is processed
+func (p *listPoller) requestAndLink(list requestList, item trakt.ListItem, link *db.ListLink) error {
+	listLinkMutex.Lock()
+	defer listLinkMutex.Unlock()
+
+	err := p.request(list, item, link)
+	if err != nil {
+		return err
+	}
+
+	err = database.SaveListLink(link)
+	if err != nil {
+		log.Printf("poller: unable to record %s %s as requested: %v", item.MediaType, item.Title, err)
+	}
+
+	return nil
+}
+
+// Request an item in overseerr and fill in the outcome on the link, errors are only returned if it should be retried
+func (p *listPoller) request(list requestList, item trakt.ListItem, link *db.ListLink) error {
+	// Anything overtrakt has already seen came from overseerr, requesting it again would echo it back
+	existing, err := database.FindTraktRequestsForMedia(item.MediaType, link.ImdbId, link.TmdbId, link.TvdbId)
+	if err != nil {
+		return err
+	}
+
+	if len(existing) > 0 {
+		link.Status = db.ListLinkStatusExisting
+		link.OverseerrRequestId = existing[0].RequestId
+		return nil
+	}
+
+	tmdbId, _ := strconv.Atoi(link.TmdbId)
+	if tmdbId == 0 {
+		link.Status = db.ListLinkStatusFailed
+		link.LastError = "trakt has no tmdb id, overseerr requires one"
+		log.Printf("poller: unable to request %s %s: %s", item.MediaType, item.Title, link.LastError)
+		return nil
+	}
+
+	mediaType := overseerr.MediaTypeMovie
+	if item.MediaType == trakt.RequestTypeTvShow {
+		mediaType = overseerr.MediaTypeTvShow
+	}
+
+	tvdbId, _ := strconv.Atoi(link.TvdbId)
+
+	request, err := p.overseerr.CreateRequest(mediaType, tmdbId, tvdbId, item.Seasons, list.overseerrUserId)
+	if overseerr.IsConflict(err) {
+		link.Status = db.ListLinkStatusExisting
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	link.Status = db.ListLinkStatusRequested
+	link.OverseerrRequestId = strconv.Itoa(request.Id)
+
+	message := fmt.Sprintf("Requested %s %s (%d) in overseerr from trakt list %s", kindForMediaType(item.MediaType), item.Title, item.Year, list.listId)
+	log.Printf("poller: %s", message)
+	notify.Message(message)
+
+	return nil
+}
+
+// Poll every list once
+func pollRequestLists() bool {
+	listPoller, err := newListPoller()
+	if err != nil {
+		log.Printf("poller: %v", err)
+		return false
+	}
+
+	if len(requestLists) == 0 {
+		log.Print("poller: TRAKT_REQUEST_LISTS is empty, there is nothing to poll")
+		return true
+	}
+
+	return listPoller.poll()
+}
+
+// Trakt accounts which own lists to request from
+func requestListAccounts() []string {
+	accounts := make([]string, 0, len(requestLists))
+	for _, list := range requestLists {
+		accounts = append(accounts, list.account)
+	}
+
+	return accounts
+}
+
+func kindForMediaType(mediaType string) string {
+	if mediaType == trakt.RequestTypeTvShow {
+		return "tv show"
+	}
+
+	return mediaType
+}
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"os/user"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	db "github.com/sjdaws/overtrakt/database"
 	"github.com/sjdaws/overtrakt/notify"
@@ -17,7 +21,7 @@ import (
 )
 
 var (
-	client   *trakt.Client
+	clients  *trakt.Registry
 	database *db.Database
 
 	databaseDbName    = os.Getenv("DATABASE_DBNAME")
@@ -28,21 +32,17 @@ var (
 	traktClientId     = os.Getenv("TRAKT_CLIENT_ID")
 	traktClientSecret = os.Getenv("TRAKT_CLIENT_SECRET")
 	traktMovieList    = os.Getenv("TRAKT_MOVIE_LIST")
+	traktRefresh      = os.Getenv("TRAKT_REFRESH_BEFORE")
+	traktRefreshLife  = os.Getenv("TRAKT_REFRESH_TOKEN_LIFETIME")
+	traktRefreshWarn  = os.Getenv("TRAKT_REFRESH_WARN_BEFORE")
 	traktTvShowList   = os.Getenv("TRAKT_TVSHOW_LIST")
+	traktTvSeasons    = os.Getenv("TRAKT_TVSHOW_SEASONS")
 	traktUser         = os.Getenv("TRAKT_USER")
-)
-
-type media struct {
-	ImdbId    string `json:"imdbId"`
-	MediaType string `json:"media_type"`
-	TmdbId    string `json:"tmdbId"`
-	TvdbId    string `json:"tvdbId"`
-}
+	unsyncedInterval  = os.Getenv("UNSYNCED_INTERVAL")
+	unsyncedMax       = os.Getenv("UNSYNCED_MAX_ATTEMPTS")
 
-type webhookBody struct {
-	Media    media  `json:"media"`
-	Username string `json:"username"`
-}
+	unsyncedMaxAttempts int
+)
 
 func init() {
 	if httpPort == "" {
@@ -57,6 +57,30 @@ func init() {
 		databaseHost = "localhost"
 	}
 
+	if unsyncedInterval == "" {
+		unsyncedInterval = "1h"
+	}
+
+	if unsyncedMax == "" {
+		unsyncedMax = "10"
+	}
+
+	if traktRefresh == "" {
+		traktRefresh = "1h"
+	}
+
+	if traktRefreshLife == "" {
+		traktRefreshLife = "2160h"
+	}
+
+	if traktRefreshWarn == "" {
+		traktRefreshWarn = "72h"
+	}
+
+	if traktTvSeasons == "" {
+		traktTvSeasons = "false"
+	}
+
 	if databaseUsername == "" {
 		currentUser, err := user.Current()
 		if err == nil {
@@ -90,54 +114,206 @@ func main() {
 		log.Fatalf("One or more mandatory env values missing: %s", strings.Join(missing, ", "))
 	}
 
-	var err error
+	err := loadNotificationActions()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = loadRequesterLists()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = loadRoutingRules()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = loadRequestLists()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	refreshOptions, err := loadRefreshOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	unsyncedMaxAttempts, err = strconv.Atoi(unsyncedMax)
+	if err != nil || unsyncedMaxAttempts < 1 {
+		log.Fatalf("invalid UNSYNCED_MAX_ATTEMPTS %s, must be a positive number", unsyncedMax)
+	}
+
+	seasonRequests, err := strconv.ParseBool(traktTvSeasons)
+	if err != nil {
+		log.Fatalf("invalid TRAKT_TVSHOW_SEASONS %s, must be true or false", traktTvSeasons)
+	}
+
 	database, err = db.Connect(databaseDbName, databaseHost, databasePassword, databaseUsername)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer database.Close()
 
-	client = trakt.NewClient(
+	// Credentials created before multiple accounts were supported belong to the default account
+	err = database.AdoptTraktAuth(traktClientId, traktUser)
+	if err != nil {
+		log.Printf("Unable to assign existing trakt credentials to %s: %v", traktUser, err)
+	}
+
+	clients = trakt.NewRegistry(
 		traktClientId,
 		traktClientSecret,
+		traktAccounts(),
 		database,
 	)
+	clients.SetSeasonRequests(seasonRequests)
 
 	args := os.Args[1:]
 
 	if len(args) == 0 {
-		http.HandleFunc("/health", health)
-		http.HandleFunc("/webhook", webhook)
-		log.Printf("Overtrakt: listening on port %s", httpPort)
-		err = http.ListenAndServe(fmt.Sprintf(":%s", httpPort), nil)
+		interval, err := time.ParseDuration(unsyncedInterval)
+		if err != nil {
+			log.Fatalf("invalid UNSYNCED_INTERVAL: %v", err)
+		}
+
+		queue, err = newWebhookQueue()
 		if err != nil {
-			log.Fatalf("unable to start http server: %v", err)
+			log.Fatal(err)
+		}
+
+		poller, err = newListPoller()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		pruner, err = newWatchedPruner()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		serve(interval, refreshOptions)
+		return
+	}
+
+	if args[0] == "deadletter" {
+		deadLetter()
+	}
+
+	if args[0] == "explain" {
+		if !explain(args[1:]) {
+			database.Close()
+			os.Exit(1)
+		}
+	}
+
+	if args[0] == "import" {
+		if len(args) < 2 || args[1] != "overseerr" {
+			log.Fatal("import: expected a source to import from, the only supported source is overseerr")
+		}
+
+		if !importOverseerr() {
+			database.Close()
+			os.Exit(1)
+		}
+	}
+
+	if args[0] == "poll" {
+		if !pollRequestLists() {
+			database.Close()
+			os.Exit(1)
+		}
+	}
+
+	if args[0] == "prune" {
+		if !pruneWatched(args[1:]) {
+			database.Close()
+			os.Exit(1)
+		}
+	}
+
+	if args[0] == "reconcile" {
+		if !reconcile(args[1:]) {
+			database.Close()
+			os.Exit(1)
 		}
 	}
 
 	if args[0] == "unsynced" {
-		unsynced()
+		if !unsynced() {
+			database.Close()
+			os.Exit(1)
+		}
+	}
+}
+
+func auth(response http.ResponseWriter, request *http.Request) {
+	if request.Method == http.MethodPost {
+		account := request.FormValue("account")
+		if account == "" {
+			account = traktUser
+		}
+
+		client, err := clients.Client(account)
+		if err != nil {
+			response.WriteHeader(404)
+			_, _ = response.Write([]byte(err.Error()))
+			return
+		}
+
+		_, err = client.StartAuthorisation()
+		if err != nil {
+			log.Printf("auth: %v", err)
+			response.WriteHeader(500)
+			_, _ = response.Write([]byte(err.Error()))
+			return
+		}
+	}
+
+	var body strings.Builder
+	for _, status := range clients.AuthStatuses() {
+		body.WriteString(fmt.Sprintf("%s: %s\n", status.Account, status.State))
+
+		if status.State == trakt.AuthStateAwaitingUserCode {
+			body.WriteString(fmt.Sprintf("  Go to %s and enter code %s before %s\n", status.VerificationUrl, status.UserCode, status.CodeExpiresAt.Format(time.RFC822)))
+		}
+	}
+
+	body.WriteString("\nPOST to /auth with an account to start a new authorisation\n")
+
+	_, err := response.Write([]byte(body.String()))
+	if err != nil {
+		log.Printf("error serving auth: %v", err)
 	}
 }
 
 func health(response http.ResponseWriter, request *http.Request) {
 	statusCode := 200
 
-	clientHealth := client.Health()
-
-	credentials, err := database.GetTraktAuth(traktClientId)
-	databaseHealth := err == nil && credentials.AccessToken != ""
+	clientHealth := clients.Health()
+	databaseHealth := database.Health()
 
 	if !clientHealth || !databaseHealth {
 		statusCode = 500
 	}
 
+	var details strings.Builder
+	for _, status := range clients.AuthStatuses() {
+		details.WriteString(fmt.Sprintf("\n%s: %s", status.Account, status.State))
+	}
+
+	lastRun, lastResult := scheduler.status()
+	if !lastRun.IsZero() {
+		details.WriteString(fmt.Sprintf("\n\nLast unsynced run: %s\nLast unsynced result: %s", lastRun.Format(time.RFC822), lastResult))
+	}
+
 	response.WriteHeader(statusCode)
 
+	var err error
 	if clientHealth && databaseHealth {
-		_, err = response.Write([]byte(fmt.Sprintf("Hello %s, I'm OK\n\nDatabase: %v\nTrakt: %v", request.RemoteAddr, databaseHealth, clientHealth)))
+		_, err = response.Write([]byte(fmt.Sprintf("Hello %s, I'm OK\n\nDatabase: %v\nTrakt: %v\n%s", request.RemoteAddr, databaseHealth, clientHealth, details.String())))
 	} else {
-		_, err = response.Write([]byte(fmt.Sprintf("Hello %s, I'm not OK\n\nDatabase: %v\nTrakt: %v", request.RemoteAddr, databaseHealth, clientHealth)))
+		_, err = response.Write([]byte(fmt.Sprintf("Hello %s, I'm not OK\n\nDatabase: %v\nTrakt: %v\n%s", request.RemoteAddr, databaseHealth, clientHealth, details.String())))
 	}
 
 	if err != nil {
@@ -145,74 +321,185 @@ func health(response http.ResponseWriter, request *http.Request) {
 	}
 }
 
-func unsynced() {
-	records, err := client.SyncUnsynced(traktMovieList, traktTvShowList, traktUser)
+// List requests which have failed too many times to be retried
+func deadLetter() {
+	requests, err := database.GetDeadLetteredRequests(unsyncedMaxAttempts)
 	if err != nil {
-		log.Fatalf("unsynced: %v", err)
-		return
+		log.Fatalf("deadletter: %v", err)
 	}
 
-	message := fmt.Sprintf("%d records synced", records)
-	log.Printf("unsynced: Complete - " + message)
+	if len(requests) == 0 {
+		log.Print("deadletter: no requests have exceeded the maximum number of attempts")
+		return
+	}
 
-	// Only notify if something happened
-	if records > 0 {
-		notify.Message("Unsynced complete: " + message)
+	for _, request := range requests {
+		log.Printf(
+			"deadletter: %s imdb=%s tmdb=%s tvdb=%s requester=%s status=%s attempts=%d last_attempt=%s error=%s",
+			request.RequestType,
+			request.ImdbId,
+			request.TmdbId,
+			request.TvdbId,
+			request.Requester,
+			request.Status,
+			request.Attempts,
+			request.LastAttemptAt.Format(time.RFC822),
+			request.LastError,
+		)
 	}
 }
 
-func webhook(response http.ResponseWriter, request *http.Request) {
-	defer closeRequestBody(request.Body)
+// Show how a webhook payload would be routed without sending anything to trakt, the payload is read from a
+// file or stdin if no file is given
+func explain(args []string) bool {
+	var payload []byte
+	var err error
+	if len(args) > 0 && args[0] != "-" {
+		payload, err = os.ReadFile(args[0])
+	} else {
+		payload, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		log.Printf("explain: %v", err)
+		return false
+	}
 
-	var webhookRequest webhookBody
-	err := json.NewDecoder(request.Body).Decode(&webhookRequest)
+	var body webhookBody
+	err = json.Unmarshal(payload, &body)
 	if err != nil {
-		log.Printf("webhook: %v", err)
-		notify.Message(fmt.Sprintf("Error reading webhook body: %v", err))
-		return
+		log.Printf("explain: unable to read payload: %v", err)
+		return false
 	}
 
-	imdbId, _ := strconv.Atoi(webhookRequest.Media.ImdbId)
-	if imdbId == 0 {
-		webhookRequest.Media.ImdbId = ""
+	action := notificationAction(body.NotificationType)
+	log.Printf("explain: %s notification action is %s", body.NotificationType, action)
+	if action != actionAdd && action != actionRemove {
+		return true
 	}
 
-	switch webhookRequest.Media.MediaType {
-	case "movie":
-		tmdbId, _ := strconv.Atoi(webhookRequest.Media.TmdbId)
-		if tmdbId == 0 {
-			webhookRequest.Media.TmdbId = ""
-		}
+	media, err := normaliseMedia(body.Media)
+	if err != nil {
+		log.Printf("explain: payload would be rejected: %v", err)
+		return false
+	}
 
-		err = client.AddMovieToUserList(webhookRequest.Media.ImdbId, webhookRequest.Media.TmdbId, traktUser, traktMovieList)
+	request := traktRequestFor(body, media)
+	targets, rules := routeRequest(request)
+	if action == actionRemove {
+		targets, rules, err = routeRemoval(request)
 		if err != nil {
-			log.Printf("webhook: %v", err)
-			response.WriteHeader(500)
-			return
+			log.Printf("explain: unable to read stored request: %v", err)
+			return false
 		}
-		break
+	}
 
-	case "tv":
-		tvdbId, _ := strconv.Atoi(webhookRequest.Media.TvdbId)
-		if tvdbId == 0 {
-			webhookRequest.Media.TvdbId = ""
+	log.Printf("explain: %s imdb=%s tmdb=%s tvdb=%s requester=%s 4k=%t seasons=%v", request.RequestType, request.ImdbId, request.TmdbId, request.TvdbId, request.Requester, request.Is4k, request.Seasons)
+	log.Printf("explain: matched %s", strings.Join(rules, ", "))
+	for _, target := range targets {
+		err = target.Validate()
+		if err != nil {
+			log.Printf("explain: %s %s: invalid: %v", action, target, err)
+			continue
 		}
 
-		err = client.AddShowToUserList(webhookRequest.Media.ImdbId, webhookRequest.Media.TvdbId, traktUser, traktTvShowList)
+		log.Printf("explain: %s %s", action, target)
+	}
+
+	return true
+}
+
+// Run the http server and background jobs until interrupted
+func serve(interval time.Duration, refreshOptions trakt.RefreshOptions) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	clients.StartRefresher(ctx, refreshOptions)
+	go scheduler.run(ctx, interval)
+	go queue.run(ctx)
+	go poller.run(ctx)
+	go pruner.run(ctx)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth", auth)
+	mux.HandleFunc("/health", health)
+	mux.HandleFunc("/webhook", webhook)
+	mux.HandleFunc("/webhook/radarr", arrWebhook(arrSourceRadarr))
+	mux.HandleFunc("/webhook/sonarr", arrWebhook(arrSourceSonarr))
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%s", httpPort),
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		log.Print("Overtrakt: shutting down")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := server.Shutdown(shutdownCtx)
 		if err != nil {
-			log.Printf("webhook: %v", err)
-			response.WriteHeader(500)
-			return
+			log.Printf("unable to shut down http server: %v", err)
 		}
-		break
+	}()
+
+	log.Printf("Overtrakt: listening on port %s", httpPort)
+	err := server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatalf("unable to start http server: %v", err)
+	}
+
+	queue.wait()
+	poller.wait()
+	pruner.wait()
+	scheduler.wait()
+}
+
+func syncUnsynced() (*trakt.SyncReport, error) {
+	report, err := clients.SyncUnsynced(targetsForRequest, unsyncedMaxAttempts)
+	if err != nil {
+		log.Printf("unsynced: %v", err)
+		return nil, err
+	}
+
+	log.Printf("unsynced: Complete - %s", report)
+
+	// Only notify if something happened
+	if report.Total() > 0 {
+		notify.Message(fmt.Sprintf("Unsynced complete: %s", report))
 	}
 
-	response.WriteHeader(201)
+	return report, nil
+}
+
+func unsynced() bool {
+	report, err := syncUnsynced()
+
+	return err == nil && !report.Failed()
 }
 
-func closeRequestBody(body io.ReadCloser) {
-	err := body.Close()
+func loadRefreshOptions() (trakt.RefreshOptions, error) {
+	before, err := time.ParseDuration(traktRefresh)
 	if err != nil {
-		log.Printf("Error closing request body: %v", err)
+		return trakt.RefreshOptions{}, fmt.Errorf("invalid TRAKT_REFRESH_BEFORE: %v", err)
 	}
+
+	lifetime, err := time.ParseDuration(traktRefreshLife)
+	if err != nil {
+		return trakt.RefreshOptions{}, fmt.Errorf("invalid TRAKT_REFRESH_TOKEN_LIFETIME: %v", err)
+	}
+
+	warn, err := time.ParseDuration(traktRefreshWarn)
+	if err != nil {
+		return trakt.RefreshOptions{}, fmt.Errorf("invalid TRAKT_REFRESH_WARN_BEFORE: %v", err)
+	}
+
+	options := trakt.RefreshOptions{
+		Before:               before,
+		RefreshTokenLifetime: lifetime,
+		WarnBefore:           warn,
+	}
+
+	return options, options.Validate()
 }
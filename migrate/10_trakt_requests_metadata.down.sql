@@ -0,0 +1,9 @@
+ALTER TABLE trakt_requests
+    DROP COLUMN overseerr_request_id,
+    DROP COLUMN requester_email,
+    DROP COLUMN subject,
+    DROP COLUMN message,
+    DROP COLUMN image,
+    DROP COLUMN is_4k,
+    DROP COLUMN seasons,
+    DROP COLUMN extra;
\ No newline at end of file
@@ -0,0 +1,9 @@
+ALTER TABLE trakt_requests
+    ADD COLUMN overseerr_request_id varchar(20) NOT NULL DEFAULT '' AFTER requester,
+    ADD COLUMN requester_email varchar(255) NOT NULL DEFAULT '' AFTER overseerr_request_id,
+    ADD COLUMN subject varchar(255) NOT NULL DEFAULT '' AFTER requester_email,
+    ADD COLUMN message text NULL AFTER subject,
+    ADD COLUMN image varchar(1024) NOT NULL DEFAULT '' AFTER message,
+    ADD COLUMN is_4k BOOL NOT NULL DEFAULT FALSE AFTER image,
+    ADD COLUMN seasons varchar(255) NOT NULL DEFAULT '' AFTER is_4k,
+    ADD COLUMN extra text NULL AFTER seasons;
\ No newline at end of file
@@ -0,0 +1,4 @@
+DELETE uhd FROM trakt_requests uhd
+    JOIN trakt_requests hd ON hd.imdb_id = uhd.imdb_id AND hd.request_type = uhd.request_type AND hd.tmdb_id = uhd.tmdb_id AND hd.tvdb_id = uhd.tvdb_id AND hd.requester = uhd.requester AND hd.is_4k = 0
+    WHERE uhd.is_4k = 1;
+ALTER TABLE trakt_requests DROP PRIMARY KEY, ADD PRIMARY KEY (imdb_id, request_type, tmdb_id, tvdb_id, requester);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE trakt_requests DROP PRIMARY KEY, ADD PRIMARY KEY (imdb_id, request_type, tmdb_id, tvdb_id, requester, is_4k);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE trakt_requests DROP COLUMN notification_type;
\ No newline at end of file
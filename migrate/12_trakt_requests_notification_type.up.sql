@@ -0,0 +1 @@
+ALTER TABLE trakt_requests ADD COLUMN notification_type varchar(64) NOT NULL DEFAULT '' AFTER extra;
\ No newline at end of file
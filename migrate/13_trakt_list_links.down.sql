@@ -0,0 +1 @@
+DROP TABLE trakt_list_links;
\ No newline at end of file
@@ -0,0 +1,14 @@
+CREATE TABLE trakt_list_links (
+    account varchar(255) NOT NULL,
+    list_id varchar(255) NOT NULL,
+    media_type varchar(10) NOT NULL,
+    trakt_id varchar(20) NOT NULL,
+    imdb_id varchar(20) NOT NULL DEFAULT '',
+    tmdb_id varchar(20) NOT NULL DEFAULT '',
+    tvdb_id varchar(20) NOT NULL DEFAULT '',
+    overseerr_request_id varchar(20) NOT NULL DEFAULT '',
+    status enum('requested', 'existing', 'failed') NOT NULL,
+    last_error varchar(1024) NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (account, list_id, media_type, trakt_id)
+);
\ No newline at end of file
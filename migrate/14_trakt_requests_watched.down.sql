@@ -0,0 +1,2 @@
+UPDATE trakt_requests SET status = 'removed' WHERE status = 'watched';
+ALTER TABLE trakt_requests MODIFY COLUMN status enum('pending', 'synced', 'not_found', 'failed', 'removed') NOT NULL DEFAULT 'pending';
\ No newline at end of file
@@ -0,0 +1,2 @@
+UPDATE trakt_requests SET status = 'removed' WHERE status = 'ignored';
+ALTER TABLE trakt_requests MODIFY COLUMN status enum('pending', 'synced', 'not_found', 'failed', 'removed', 'watched') NOT NULL DEFAULT 'pending';
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE trakt_requests MODIFY COLUMN status enum('pending', 'synced', 'not_found', 'failed', 'removed', 'watched', 'ignored') NOT NULL DEFAULT 'pending';
\ No newline at end of file
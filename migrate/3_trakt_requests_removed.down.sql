@@ -0,0 +1 @@
+ALTER TABLE trakt_requests DROP COLUMN removed;
\ No newline at end of file
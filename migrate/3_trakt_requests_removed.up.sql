@@ -0,0 +1 @@
+ALTER TABLE trakt_requests ADD COLUMN removed BOOL NOT NULL DEFAULT FALSE AFTER added;
\ No newline at end of file
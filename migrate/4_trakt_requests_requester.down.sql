@@ -0,0 +1,10 @@
+CREATE TEMPORARY TABLE trakt_requests_collapsed AS
+    SELECT imdb_id, request_type, tmdb_id, tvdb_id, MAX(added) AS added, MIN(removed) AS removed, MIN(created_at) AS created_at
+    FROM trakt_requests
+    GROUP BY imdb_id, request_type, tmdb_id, tvdb_id;
+DELETE FROM trakt_requests;
+ALTER TABLE trakt_requests DROP PRIMARY KEY, ADD PRIMARY KEY (imdb_id, request_type, tmdb_id, tvdb_id);
+ALTER TABLE trakt_requests DROP COLUMN requester;
+INSERT INTO trakt_requests (imdb_id, request_type, tmdb_id, tvdb_id, added, removed, created_at)
+    SELECT imdb_id, request_type, tmdb_id, tvdb_id, added, removed, created_at FROM trakt_requests_collapsed;
+DROP TEMPORARY TABLE trakt_requests_collapsed;
\ No newline at end of file
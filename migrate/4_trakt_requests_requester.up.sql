@@ -0,0 +1,2 @@
+ALTER TABLE trakt_requests ADD COLUMN requester varchar(255) NOT NULL DEFAULT '' AFTER tvdb_id;
+ALTER TABLE trakt_requests DROP PRIMARY KEY, ADD PRIMARY KEY (imdb_id, request_type, tmdb_id, tvdb_id, requester);
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TEMPORARY TABLE trakt_credentials_kept AS
+    SELECT client_id, account FROM trakt_credentials c
+    WHERE account = (
+        SELECT o.account FROM trakt_credentials o
+        WHERE o.client_id = c.client_id
+        ORDER BY o.account != '', o.expires_at DESC, o.account
+        LIMIT 1
+    );
+DELETE FROM trakt_credentials WHERE (client_id, account) NOT IN (SELECT client_id, account FROM trakt_credentials_kept);
+UPDATE trakt_credentials SET account = '';
+ALTER TABLE trakt_credentials DROP PRIMARY KEY, ADD PRIMARY KEY (client_id);
+ALTER TABLE trakt_credentials DROP COLUMN account;
+DROP TEMPORARY TABLE trakt_credentials_kept;
\ No newline at end of file
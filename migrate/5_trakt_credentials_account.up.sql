@@ -0,0 +1,2 @@
+ALTER TABLE trakt_credentials ADD COLUMN account varchar(64) NOT NULL DEFAULT '' AFTER client_id;
+ALTER TABLE trakt_credentials DROP PRIMARY KEY, ADD PRIMARY KEY (client_id, account);
\ No newline at end of file
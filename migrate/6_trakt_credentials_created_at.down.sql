@@ -0,0 +1 @@
+ALTER TABLE trakt_credentials DROP COLUMN created_at;
\ No newline at end of file
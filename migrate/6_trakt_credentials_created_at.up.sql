@@ -0,0 +1 @@
+ALTER TABLE trakt_credentials ADD COLUMN created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER token_type;
\ No newline at end of file
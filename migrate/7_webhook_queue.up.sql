@@ -0,0 +1,11 @@
+CREATE TABLE webhook_queue (
+    id bigint NOT NULL AUTO_INCREMENT,
+    payload mediumtext NOT NULL,
+    status varchar(10) NOT NULL DEFAULT 'pending',
+    attempts int NOT NULL DEFAULT 0,
+    last_error varchar(1024) NOT NULL DEFAULT '',
+    next_attempt_at datetime NOT NULL,
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    INDEX (status, next_attempt_at)
+);
\ No newline at end of file
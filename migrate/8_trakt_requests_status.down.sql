@@ -0,0 +1,6 @@
+ALTER TABLE trakt_requests
+    ADD COLUMN added BOOL NOT NULL DEFAULT FALSE AFTER requester,
+    ADD COLUMN removed BOOL NOT NULL DEFAULT FALSE AFTER added;
+UPDATE trakt_requests SET added = 1 WHERE status = 'synced';
+UPDATE trakt_requests SET removed = 1 WHERE status = 'removed';
+ALTER TABLE trakt_requests DROP COLUMN status, DROP COLUMN attempts, DROP COLUMN last_error, DROP COLUMN last_attempt_at, DROP COLUMN synced_at;
\ No newline at end of file
@@ -0,0 +1,9 @@
+ALTER TABLE trakt_requests
+    ADD COLUMN status enum('pending', 'synced', 'not_found', 'failed', 'removed') NOT NULL DEFAULT 'pending' AFTER requester,
+    ADD COLUMN attempts int NOT NULL DEFAULT 0 AFTER status,
+    ADD COLUMN last_error varchar(1024) NOT NULL DEFAULT '' AFTER attempts,
+    ADD COLUMN last_attempt_at datetime NULL AFTER last_error,
+    ADD COLUMN synced_at datetime NULL AFTER last_attempt_at;
+UPDATE trakt_requests SET status = 'synced', synced_at = created_at WHERE added = 1;
+UPDATE trakt_requests SET status = 'removed' WHERE removed = 1;
+ALTER TABLE trakt_requests DROP COLUMN added, DROP COLUMN removed;
\ No newline at end of file
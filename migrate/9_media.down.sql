@@ -0,0 +1 @@
+DROP TABLE media;
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE media (
+    media_type varchar(10) NOT NULL,
+    trakt_id varchar(20) NOT NULL,
+    slug varchar(255) NOT NULL DEFAULT '',
+    title varchar(255) NOT NULL DEFAULT '',
+    year int NOT NULL DEFAULT 0,
+    imdb_id varchar(20) NOT NULL DEFAULT '',
+    tmdb_id varchar(20) NOT NULL DEFAULT '',
+    tvdb_id varchar(20) NOT NULL DEFAULT '',
+    updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (media_type, trakt_id),
+    INDEX (media_type, imdb_id),
+    INDEX (media_type, tmdb_id),
+    INDEX (media_type, tvdb_id)
+);
\ No newline at end of file
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	db "github.com/sjdaws/overtrakt/database"
+	"github.com/sjdaws/overtrakt/overseerr"
+)
+
+var (
+	overseerrApiKey = os.Getenv("OVERSEERR_API_KEY")
+	overseerrUrl    = os.Getenv("OVERSEERR_URL")
+)
+
+// Create an overseerr client, the url defaults to overseerr's default port on localhost
+func newOverseerrClient() (*overseerr.Client, error) {
+	if overseerrApiKey == "" {
+		return nil, fmt.Errorf("OVERSEERR_API_KEY must be set to use the overseerr api")
+	}
+
+	baseUrl := overseerrUrl
+	if baseUrl == "" {
+		baseUrl = "http://localhost:5055"
+	}
+
+	return overseerr.NewClient(baseUrl, overseerrApiKey), nil
+}
+
+// Backfill requests made before overtrakt was running, every request is stored with the status its current state
+// maps to and only those which would be added by a webhook are queued for the unsynced job, requests which are
+// already stored are left alone so running it again doesn't change anything
+func importOverseerr() bool {
+	client, err := newOverseerrClient()
+	if err != nil {
+		log.Printf("import: %v", err)
+		return false
+	}
+
+	overseerrRequests, err := client.Requests()
+	if err != nil {
+		log.Printf("import: %v", err)
+		return false
+	}
+
+	var existing, invalid, queued, stored int
+
+	requests := make([]*db.TraktRequest, 0, len(overseerrRequests))
+	byKey := make(map[string]*db.TraktRequest)
+	for _, overseerrRequest := range overseerrRequests {
+		request, err := traktRequestForOverseerr(overseerrRequest)
+		if err != nil {
+			log.Printf("import: skipping overseerr request %d: %v", overseerrRequest.Id, err)
+			invalid++
+			continue
+		}
+
+		request.Status = importStatus(notificationAction(request.NotificationType))
+
+		// Overseerr has a request per set of seasons, they share a row here
+		key := importKey(request)
+		if previous, ok := byKey[key]; ok {
+			combineImported(previous, request)
+			continue
+		}
+
+		byKey[key] = request
+		requests = append(requests, request)
+	}
+
+	for _, request := range requests {
+		inserted, err := clients.Queue(request)
+		if err != nil {
+			log.Printf("import: unable to store overseerr request %s: %v", request.RequestId, err)
+			invalid++
+			continue
+		}
+
+		switch {
+		case !inserted:
+			existing++
+
+		case request.Status == db.RequestStatusPending:
+			queued++
+
+		default:
+			stored++
+		}
+	}
+
+	log.Printf("import: %d request(s) read from overseerr, %d queued for sync, %d stored without syncing, %d already stored, %d invalid", len(overseerrRequests), queued, stored, existing, invalid)
+
+	return invalid == 0
+}
+
+// The status an imported request is stored with, only requests which would be added are synced
+func importStatus(action action) string {
+	switch action {
+	case actionAdd:
+		return db.RequestStatusPending
+
+	case actionRemove:
+		return db.RequestStatusRemoved
+	}
+
+	return db.RequestStatusIgnored
+}
+
+// Imported requests for the same media, requester and quality are stored in the same row
+func importKey(request *db.TraktRequest) string {
+	return fmt.Sprintf("%s:%s:%s:%s:%s:%t", request.RequestType, request.ImdbId, request.TmdbId, request.TvdbId, request.Requester, request.Is4k)
+}
+
+// Combine a request into an earlier one for the same row, a request which would be added wins over one which would
+// be removed or ignored and seasons are combined between requests with the same status
+func combineImported(previous *db.TraktRequest, request *db.TraktRequest) {
+	rank := map[string]int{
+		db.RequestStatusPending: 0,
+		db.RequestStatusRemoved: 1,
+		db.RequestStatusIgnored: 2,
+	}
+
+	if rank[request.Status] > rank[previous.Status] {
+		return
+	}
+
+	if rank[request.Status] < rank[previous.Status] {
+		*previous = *request
+		return
+	}
+
+	previous.Seasons = db.CombineSeasons(previous.Seasons, request.Seasons)
+}
+
+// Map a request from the overseerr api to the request a webhook for it would have created
+func traktRequestForOverseerr(request overseerr.Request) (*db.TraktRequest, error) {
+	media, err := normaliseMedia(media{
+		ImdbId:    request.Media.ImdbId,
+		MediaType: request.Media.MediaType,
+		TmdbId:    strconv.Itoa(request.Media.TmdbId),
+		TvdbId:    strconv.Itoa(request.Media.TvdbId),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &db.TraktRequest{
+		ImdbId:           media.ImdbId,
+		RequestType:      requestTypeFor(media.MediaType),
+		TmdbId:           media.TmdbId,
+		TvdbId:           media.TvdbId,
+		Requester:        request.RequestedBy.Name(),
+		RequestId:        strconv.Itoa(request.Id),
+		RequesterMail:    request.RequestedBy.Email,
+		Is4k:             request.Is4k,
+		Seasons:          request.SeasonNumbers(),
+		NotificationType: notificationTypeFor(request),
+	}, nil
+}
+
+// The notification overseerr would have sent for the current state of a request
+func notificationTypeFor(request overseerr.Request) string {
+	switch request.Status {
+	case overseerr.RequestStatusApproved:
+		status := request.Media.Status
+		if request.Is4k {
+			status = request.Media.Status4k
+		}
+
+		if status == overseerr.MediaStatusAvailable {
+			return notificationMediaAvailable
+		}
+
+		return notificationMediaApproved
+
+	case overseerr.RequestStatusDeclined:
+		return notificationMediaDeclined
+
+	case overseerr.RequestStatusFailed:
+		return notificationMediaFailed
+	}
+
+	return notificationMediaPending
+}
@@ -0,0 +1,117 @@
+package overseerr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client talks to the overseerr api using an api key
+type Client struct {
+	apiKey     string
+	baseUrl    string
+	httpClient *http.Client
+}
+
+// ApiError is returned when overseerr responds with an error status
+type ApiError struct {
+	Message    string
+	Path       string
+	StatusCode int
+}
+
+type requestParameters struct {
+	body   interface{}
+	method string
+	path   string
+}
+
+func NewClient(baseUrl string, apiKey string) *Client {
+	return &Client{
+		apiKey:  apiKey,
+		baseUrl: strings.TrimRight(baseUrl, "/"),
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// Send a request to the api and decode the response into result if it's not nil
+func (c *Client) queryApi(parameters requestParameters, result interface{}) error {
+	var body io.Reader
+	if parameters.body != nil {
+		encoded, err := json.Marshal(parameters.body)
+		if err != nil {
+			return fmt.Errorf("overseerr: %w", err)
+		}
+
+		body = bytes.NewReader(encoded)
+	}
+
+	if parameters.method == "" {
+		parameters.method = http.MethodGet
+	}
+
+	request, err := http.NewRequest(parameters.method, c.baseUrl+"/api/v1"+parameters.path, body)
+	if err != nil {
+		return fmt.Errorf("overseerr: %w", err)
+	}
+
+	request.Header.Add("Accept", "application/json")
+	request.Header.Add("X-Api-Key", c.apiKey)
+
+	if body != nil {
+		request.Header.Add("Content-Type", "application/json")
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("overseerr: %w", err)
+	}
+
+	defer c.close(response.Body)
+
+	if response.StatusCode >= 400 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return &ApiError{
+			Message:    strings.TrimSpace(string(message)),
+			Path:       parameters.path,
+			StatusCode: response.StatusCode,
+		}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(response.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("overseerr: %w", err)
+	}
+
+	return nil
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("overseerr: %s responded with status %d: %s", e.Path, e.StatusCode, e.Message)
+}
+
+// IsConflict reports whether overseerr rejected a request because it already exists
+func IsConflict(err error) bool {
+	var apiError *ApiError
+
+	return errors.As(err, &apiError) && apiError.StatusCode == http.StatusConflict
+}
+
+func (c *Client) close(body io.ReadCloser) {
+	err := body.Close()
+	if err != nil {
+		log.Printf("overseerr: error closing response body: %v", err)
+	}
+}
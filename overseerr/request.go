@@ -0,0 +1,159 @@
+package overseerr
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	MediaTypeMovie  = "movie"
+	MediaTypeTvShow = "tv"
+)
+
+// Request statuses
+const (
+	RequestStatusPending  = 1
+	RequestStatusApproved = 2
+	RequestStatusDeclined = 3
+	RequestStatusFailed   = 4
+)
+
+// Media statuses
+const (
+	MediaStatusUnknown            = 1
+	MediaStatusPending            = 2
+	MediaStatusProcessing         = 3
+	MediaStatusPartiallyAvailable = 4
+	MediaStatusAvailable          = 5
+)
+
+// Number of requests fetched per page
+const requestPageSize = 100
+
+type Media struct {
+	Id        int    `json:"id"`
+	ImdbId    string `json:"imdbId"`
+	MediaType string `json:"mediaType"`
+	Status    int    `json:"status"`
+	Status4k  int    `json:"status4k"`
+	TmdbId    int    `json:"tmdbId"`
+	TvdbId    int    `json:"tvdbId"`
+}
+
+type Request struct {
+	CreatedAt   time.Time `json:"createdAt"`
+	Id          int       `json:"id"`
+	Is4k        bool      `json:"is4k"`
+	Media       Media     `json:"media"`
+	RequestedBy User      `json:"requestedBy"`
+	Seasons     []Season  `json:"seasons"`
+	Status      int       `json:"status"`
+	Type        string    `json:"type"`
+}
+
+type Season struct {
+	SeasonNumber int `json:"seasonNumber"`
+}
+
+type User struct {
+	DisplayName  string `json:"displayName"`
+	Email        string `json:"email"`
+	Id           int    `json:"id"`
+	PlexUsername string `json:"plexUsername"`
+	Username     string `json:"username"`
+}
+
+type createRequest struct {
+	Is4k      bool        `json:"is4k"`
+	MediaId   int         `json:"mediaId"`
+	MediaType string      `json:"mediaType"`
+	Seasons   interface{} `json:"seasons,omitempty"`
+	TvdbId    int         `json:"tvdbId,omitempty"`
+	UserId    int         `json:"userId,omitempty"`
+}
+
+type pageInfo struct {
+	Page    int `json:"page"`
+	Pages   int `json:"pages"`
+	Results int `json:"results"`
+}
+
+type requestPage struct {
+	PageInfo pageInfo  `json:"pageInfo"`
+	Results  []Request `json:"results"`
+}
+
+// Requests pages through every request overseerr knows about, oldest first
+func (c *Client) Requests() ([]Request, error) {
+	requests := make([]Request, 0)
+
+	for skip := 0; ; skip += requestPageSize {
+		var page requestPage
+		err := c.queryApi(requestParameters{
+			path: fmt.Sprintf("/request?take=%d&skip=%d&filter=all&sort=added", requestPageSize, skip),
+		}, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, page.Results...)
+
+		if len(page.Results) < requestPageSize || len(requests) >= page.PageInfo.Results {
+			break
+		}
+	}
+
+	return requests, nil
+}
+
+// CreateRequest requests media on behalf of a user, tv shows are requested with every season unless seasons are
+// given, media is identified by its tmdb id
+func (c *Client) CreateRequest(mediaType string, tmdbId int, tvdbId int, seasons []int, userId int) (*Request, error) {
+	body := createRequest{
+		MediaId:   tmdbId,
+		MediaType: mediaType,
+		UserId:    userId,
+	}
+
+	if mediaType == MediaTypeTvShow {
+		body.TvdbId = tvdbId
+		body.Seasons = "all"
+		if len(seasons) > 0 {
+			body.Seasons = seasons
+		}
+	}
+
+	var request Request
+	err := c.queryApi(requestParameters{
+		body:   body,
+		method: http.MethodPost,
+		path:   "/request",
+	}, &request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+// Name is how the user appears in webhooks
+func (u User) Name() string {
+	for _, name := range []string{u.DisplayName, u.Username, u.PlexUsername} {
+		if name != "" {
+			return name
+		}
+	}
+
+	return u.Email
+}
+
+// SeasonNumbers are the seasons included in a tv request
+func (r Request) SeasonNumbers() []int {
+	seasons := make([]int, 0, len(r.Seasons))
+	for _, season := range r.Seasons {
+		seasons = append(seasons, season.SeasonNumber)
+	}
+
+	return seasons
+}
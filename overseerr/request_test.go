@@ -0,0 +1,114 @@
+package overseerr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// Serve total requests from a stub of the overseerr request endpoint, recording the skip of each page requested
+func requestServer(t *testing.T, total int, skips *[]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/api/v1/request" {
+			t.Errorf("unexpected path %s", request.URL.Path)
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if request.Header.Get("X-Api-Key") != "key" {
+			t.Errorf("expected api key header, got %q", request.Header.Get("X-Api-Key"))
+		}
+
+		query := request.URL.Query()
+		take, _ := strconv.Atoi(query.Get("take"))
+		skip, _ := strconv.Atoi(query.Get("skip"))
+		*skips = append(*skips, skip)
+
+		if take != requestPageSize {
+			t.Errorf("expected take=%d, got %d", requestPageSize, take)
+		}
+
+		page := requestPage{
+			PageInfo: pageInfo{
+				Page:    skip/take + 1,
+				Pages:   (total + take - 1) / take,
+				Results: total,
+			},
+			Results: make([]Request, 0),
+		}
+
+		for id := skip + 1; id <= total && id <= skip+take; id++ {
+			page.Results = append(page.Results, Request{Id: id})
+		}
+
+		_ = json.NewEncoder(response).Encode(page)
+	}))
+}
+
+func TestRequestsPages(t *testing.T) {
+	tests := []struct {
+		name      string
+		total     int
+		wantSkips []int
+	}{
+		{name: "empty", total: 0, wantSkips: []int{0}},
+		{name: "partial page", total: 42, wantSkips: []int{0}},
+		{name: "full pages", total: 200, wantSkips: []int{0, 100}},
+		{name: "partial last page", total: 250, wantSkips: []int{0, 100, 200}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			skips := make([]int, 0)
+			server := requestServer(t, test.total, &skips)
+			defer server.Close()
+
+			requests, err := NewClient(server.URL+"/", "key").Requests()
+			if err != nil {
+				t.Fatalf("Requests returned error: %v", err)
+			}
+
+			if len(requests) != test.total {
+				t.Errorf("expected %d requests, got %d", test.total, len(requests))
+			}
+
+			for i, request := range requests {
+				if request.Id != i+1 {
+					t.Errorf("expected request %d to have id %d, got %d", i, i+1, request.Id)
+					break
+				}
+			}
+
+			if len(skips) != len(test.wantSkips) {
+				t.Fatalf("expected skips %v, got %v", test.wantSkips, skips)
+			}
+
+			for i := range skips {
+				if skips[i] != test.wantSkips[i] {
+					t.Fatalf("expected skips %v, got %v", test.wantSkips, skips)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		response.WriteHeader(http.StatusUnauthorized)
+		_, _ = response.Write([]byte("invalid api key"))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL, "key").Requests()
+
+	apiError, ok := err.(*ApiError)
+	if !ok {
+		t.Fatalf("expected an ApiError, got %v", err)
+	}
+
+	if apiError.StatusCode != http.StatusUnauthorized || apiError.Message != "invalid api key" {
+		t.Errorf("unexpected error %v", apiError)
+	}
+}
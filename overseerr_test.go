@@ -0,0 +1,178 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	db "github.com/sjdaws/overtrakt/database"
+	"github.com/sjdaws/overtrakt/overseerr"
+	"github.com/sjdaws/overtrakt/trakt"
+)
+
+func TestNotificationTypeFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		request overseerr.Request
+		want    string
+	}{
+		{
+			name:    "pending",
+			request: overseerr.Request{Status: overseerr.RequestStatusPending},
+			want:    notificationMediaPending,
+		},
+		{
+			name:    "approved",
+			request: overseerr.Request{Status: overseerr.RequestStatusApproved, Media: overseerr.Media{Status: overseerr.MediaStatusProcessing}},
+			want:    notificationMediaApproved,
+		},
+		{
+			name:    "available",
+			request: overseerr.Request{Status: overseerr.RequestStatusApproved, Media: overseerr.Media{Status: overseerr.MediaStatusAvailable}},
+			want:    notificationMediaAvailable,
+		},
+		{
+			name:    "4k uses the 4k status",
+			request: overseerr.Request{Is4k: true, Status: overseerr.RequestStatusApproved, Media: overseerr.Media{Status: overseerr.MediaStatusAvailable, Status4k: overseerr.MediaStatusProcessing}},
+			want:    notificationMediaApproved,
+		},
+		{
+			name:    "4k available",
+			request: overseerr.Request{Is4k: true, Status: overseerr.RequestStatusApproved, Media: overseerr.Media{Status4k: overseerr.MediaStatusAvailable}},
+			want:    notificationMediaAvailable,
+		},
+		{
+			name:    "declined",
+			request: overseerr.Request{Status: overseerr.RequestStatusDeclined},
+			want:    notificationMediaDeclined,
+		},
+		{
+			name:    "failed",
+			request: overseerr.Request{Status: overseerr.RequestStatusFailed},
+			want:    notificationMediaFailed,
+		},
+	}
+
+	for _, test := range tests {
+		got := notificationTypeFor(test.request)
+		if got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.name, test.want, got)
+		}
+	}
+}
+
+func TestImportStatus(t *testing.T) {
+	tests := map[string]string{
+		notificationMediaApproved:  db.RequestStatusPending,
+		notificationMediaAvailable: db.RequestStatusPending,
+		notificationMediaDeclined:  db.RequestStatusRemoved,
+		notificationMediaFailed:    db.RequestStatusIgnored,
+		notificationMediaPending:   db.RequestStatusIgnored,
+	}
+
+	for notificationType, want := range tests {
+		got := importStatus(notificationAction(notificationType))
+		if got != want {
+			t.Errorf("%s: expected %s, got %s", notificationType, want, got)
+		}
+	}
+}
+
+func TestTraktRequestForOverseerr(t *testing.T) {
+	request, err := traktRequestForOverseerr(overseerr.Request{
+		Id:   12,
+		Is4k: true,
+		Media: overseerr.Media{
+			ImdbId:    "tt0903747",
+			MediaType: overseerr.MediaTypeTvShow,
+			TmdbId:    1396,
+			TvdbId:    81189,
+		},
+		RequestedBy: overseerr.User{DisplayName: "Jesse", Email: "jesse@example.com"},
+		Seasons:     []overseerr.Season{{SeasonNumber: 1}, {SeasonNumber: 2}},
+		Status:      overseerr.RequestStatusDeclined,
+	})
+	if err != nil {
+		t.Fatalf("traktRequestForOverseerr returned error: %v", err)
+	}
+
+	want := &db.TraktRequest{
+		ImdbId:           "tt0903747",
+		RequestType:      trakt.RequestTypeTvShow,
+		TvdbId:           "81189",
+		Requester:        "Jesse",
+		RequestId:        "12",
+		RequesterMail:    "jesse@example.com",
+		Is4k:             true,
+		Seasons:          []int{1, 2},
+		NotificationType: notificationMediaDeclined,
+	}
+
+	if !reflect.DeepEqual(request, want) {
+		t.Errorf("expected %+v, got %+v", want, request)
+	}
+}
+
+func TestTraktRequestForOverseerrMovie(t *testing.T) {
+	request, err := traktRequestForOverseerr(overseerr.Request{
+		Id: 7,
+		Media: overseerr.Media{
+			MediaType: overseerr.MediaTypeMovie,
+			TmdbId:    603,
+			TvdbId:    1234,
+		},
+		RequestedBy: overseerr.User{Username: "neo"},
+		Status:      overseerr.RequestStatusApproved,
+	})
+	if err != nil {
+		t.Fatalf("traktRequestForOverseerr returned error: %v", err)
+	}
+
+	if request.RequestType != trakt.RequestTypeMovie || request.TmdbId != "603" || request.TvdbId != "" || request.ImdbId != "" {
+		t.Errorf("unexpected ids for movie %+v", request)
+	}
+
+	if request.Requester != "neo" || request.NotificationType != notificationMediaApproved {
+		t.Errorf("unexpected requester or notification type %+v", request)
+	}
+}
+
+func TestTraktRequestForOverseerrInvalid(t *testing.T) {
+	_, err := traktRequestForOverseerr(overseerr.Request{
+		Media: overseerr.Media{
+			MediaType: overseerr.MediaTypeMovie,
+		},
+	})
+	if err == nil {
+		t.Error("expected an error for a movie without ids")
+	}
+}
+
+func TestCombineImported(t *testing.T) {
+	approved := func(seasons ...int) *db.TraktRequest {
+		return &db.TraktRequest{RequestId: "approved", Seasons: seasons, Status: db.RequestStatusPending}
+	}
+	declined := func(seasons ...int) *db.TraktRequest {
+		return &db.TraktRequest{RequestId: "declined", Seasons: seasons, Status: db.RequestStatusRemoved}
+	}
+
+	tests := []struct {
+		name        string
+		previous    *db.TraktRequest
+		request     *db.TraktRequest
+		wantId      string
+		wantSeasons []int
+	}{
+		{name: "seasons are combined", previous: approved(1), request: approved(2, 3), wantId: "approved", wantSeasons: []int{1, 2, 3}},
+		{name: "every season wins", previous: approved(1), request: approved(), wantId: "approved", wantSeasons: []int{}},
+		{name: "added wins over removed", previous: declined(1), request: approved(2), wantId: "approved", wantSeasons: []int{2}},
+		{name: "removed doesn't replace added", previous: approved(1), request: declined(2), wantId: "approved", wantSeasons: []int{1}},
+	}
+
+	for _, test := range tests {
+		combineImported(test.previous, test.request)
+
+		if test.previous.RequestId != test.wantId || !reflect.DeepEqual(test.previous.Seasons, test.wantSeasons) {
+			t.Errorf("%s: expected %s with seasons %v, got %s with seasons %v", test.name, test.wantId, test.wantSeasons, test.previous.RequestId, test.previous.Seasons)
+		}
+	}
+}
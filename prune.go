@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sjdaws/overtrakt/notify"
+)
+
+var (
+	pruneDryRun   = os.Getenv("PRUNE_DRY_RUN")
+	pruneGrace    = os.Getenv("PRUNE_GRACE")
+	pruneInterval = os.Getenv("PRUNE_INTERVAL")
+)
+
+// Periodically removes watched requests from trakt while the server is running
+type watchedPruner struct {
+	done     chan struct{}
+	dryRun   bool
+	grace    time.Duration
+	interval time.Duration
+}
+
+var pruner *watchedPruner
+
+// Create the pruner from env, it's disabled unless PRUNE_INTERVAL is set and the grace period defaults to a week
+func newWatchedPruner() (*watchedPruner, error) {
+	pruner := &watchedPruner{
+		done:  make(chan struct{}),
+		grace: 7 * 24 * time.Hour,
+	}
+
+	var err error
+	if pruneInterval != "" {
+		pruner.interval, err = time.ParseDuration(pruneInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PRUNE_INTERVAL: %v", err)
+		}
+	}
+
+	if pruneGrace != "" {
+		pruner.grace, err = time.ParseDuration(pruneGrace)
+		if err != nil || pruner.grace < 0 {
+			return nil, fmt.Errorf("invalid PRUNE_GRACE %s, must be a positive duration", pruneGrace)
+		}
+	}
+
+	if pruneDryRun != "" {
+		pruner.dryRun, err = strconv.ParseBool(pruneDryRun)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PRUNE_DRY_RUN %s, must be true or false", pruneDryRun)
+		}
+	}
+
+	return pruner, nil
+}
+
+// Run until the context is cancelled, a zero interval disables the pruner
+func (p *watchedPruner) run(ctx context.Context) {
+	defer close(p.done)
+
+	if p.interval <= 0 {
+		return
+	}
+
+	log.Printf("prune: removing items watched more than %s ago every %s", p.grace, p.interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.interval):
+		}
+
+		p.prune()
+	}
+}
+
+// Wait for an in progress run to finish
+func (p *watchedPruner) wait() {
+	<-p.done
+}
+
+// Remove watched requests once, returns false if anything couldn't be checked or removed
+func (p *watchedPruner) prune() bool {
+	report, err := clients.PruneWatched(removalTargetsForRequest, p.grace, p.dryRun)
+	if err != nil {
+		log.Printf("prune: %v", err)
+		return false
+	}
+
+	for _, pruned := range report.Pruned {
+		if p.dryRun {
+			log.Printf("prune: would remove %s", pruned)
+		} else {
+			log.Printf("prune: removed %s", pruned)
+		}
+	}
+
+	for _, err := range report.Errors {
+		log.Printf("prune: %v", err)
+	}
+
+	log.Printf("prune: Complete - %s", report)
+
+	// Only notify if something happened
+	if !p.dryRun && len(report.Pruned)+len(report.Errors) > 0 {
+		notify.Message(fmt.Sprintf("Prune complete: %s", report))
+	}
+
+	return len(report.Errors) == 0 && len(report.Unauthorised) == 0
+}
+
+// Prune watched requests once, -dry-run lists what would be removed without changing anything
+func pruneWatched(args []string) bool {
+	watched, err := newWatchedPruner()
+	if err != nil {
+		log.Printf("prune: %v", err)
+		return false
+	}
+
+	flags := flag.NewFlagSet("prune", flag.ContinueOnError)
+	flags.BoolVar(&watched.dryRun, "dry-run", watched.dryRun, "list what would be removed without removing anything")
+	flags.DurationVar(&watched.grace, "grace", watched.grace, "how long after being watched items are removed")
+
+	err = flags.Parse(args)
+	if err != nil {
+		return false
+	}
+
+	return watched.prune()
+}
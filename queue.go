@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	db "github.com/sjdaws/overtrakt/database"
+	"github.com/sjdaws/overtrakt/notify"
+	"github.com/sjdaws/overtrakt/trakt"
+)
+
+const (
+	queueMaxBackoff   = 6 * time.Hour
+	queueMinBackoff   = 30 * time.Second
+	queuePollInterval = 5 * time.Second
+)
+
+var (
+	webhookMaxAttempts = os.Getenv("WEBHOOK_MAX_ATTEMPTS")
+	webhookWorkers     = os.Getenv("WEBHOOK_WORKERS")
+)
+
+// Processes stored webhooks in the background so overseerr isn't kept waiting on trakt
+type webhookQueue struct {
+	done        chan struct{}
+	maxAttempts int
+	wake        chan struct{}
+	workers     int
+}
+
+var queue *webhookQueue
+
+func newWebhookQueue() (*webhookQueue, error) {
+	maxAttempts := 10
+	if webhookMaxAttempts != "" {
+		var err error
+		maxAttempts, err = strconv.Atoi(webhookMaxAttempts)
+		if err != nil || maxAttempts < 1 {
+			return nil, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS %s, must be a positive number", webhookMaxAttempts)
+		}
+	}
+
+	workers := 2
+	if webhookWorkers != "" {
+		var err error
+		workers, err = strconv.Atoi(webhookWorkers)
+		if err != nil || workers < 1 {
+			return nil, fmt.Errorf("invalid WEBHOOK_WORKERS %s, must be a positive number", webhookWorkers)
+		}
+	}
+
+	return &webhookQueue{
+		done:        make(chan struct{}),
+		maxAttempts: maxAttempts,
+		wake:        make(chan struct{}, 1),
+		workers:     workers,
+	}, nil
+}
+
+// Add a webhook payload to the queue
+func (q *webhookQueue) enqueue(payload []byte) error {
+	_, err := database.EnqueueWebhook(string(payload))
+	if err != nil {
+		return err
+	}
+
+	// Don't wait for the next poll if a worker is free
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Process the queue until the context is cancelled
+func (q *webhookQueue) run(ctx context.Context) {
+	defer close(q.done)
+
+	err := database.ResetProcessingWebhooks()
+	if err != nil {
+		log.Printf("queue: unable to reset webhooks left processing: %v", err)
+	}
+
+	jobs := make(chan *db.QueuedWebhook)
+
+	var workers sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for webhook := range jobs {
+				q.process(webhook)
+			}
+		}()
+	}
+
+	defer workers.Wait()
+	defer close(jobs)
+
+	for {
+		webhooks, err := database.ClaimDueWebhooks(q.workers)
+		if err != nil {
+			log.Printf("queue: unable to claim webhooks: %v", err)
+		}
+
+		for index, webhook := range webhooks {
+			select {
+			case jobs <- webhook:
+			case <-ctx.Done():
+				// Return anything unprocessed to the queue for next time
+				for _, unprocessed := range webhooks[index:] {
+					unprocessed.Status = db.WebhookStatusPending
+					q.update(unprocessed)
+				}
+				return
+			}
+		}
+
+		// Keep going while there is a backlog
+		if len(webhooks) == q.workers {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-time.After(queuePollInterval):
+		}
+	}
+}
+
+// Wait for in progress webhooks to finish
+func (q *webhookQueue) wait() {
+	<-q.done
+}
+
+func (q *webhookQueue) process(webhook *db.QueuedWebhook) {
+	webhook.Attempts++
+
+	err := processWebhook([]byte(webhook.Payload))
+	if err == nil {
+		webhook.LastError = ""
+		webhook.Status = db.WebhookStatusDone
+		q.update(webhook)
+		return
+	}
+
+	webhook.LastError = err.Error()
+
+	if !trakt.IsTemporary(err) || webhook.Attempts >= q.maxAttempts {
+		log.Printf("queue: giving up on webhook %d after %d attempt(s): %v", webhook.Id, webhook.Attempts, err)
+		notify.Message(fmt.Sprintf("Unable to process webhook after %d attempt(s): %v", webhook.Attempts, err))
+		webhook.Status = db.WebhookStatusFailed
+		q.update(webhook)
+		return
+	}
+
+	backoff := trakt.RetryAfter(err)
+	if backoff <= 0 {
+		backoff = queueMinBackoff << (webhook.Attempts - 1)
+		if backoff > queueMaxBackoff || backoff <= 0 {
+			backoff = queueMaxBackoff
+		}
+	}
+
+	log.Printf("queue: webhook %d failed, retrying in %s: %v", webhook.Id, backoff, err)
+	webhook.NextAttemptAt = time.Now().Add(backoff)
+	webhook.Status = db.WebhookStatusPending
+	q.update(webhook)
+}
+
+func (q *webhookQueue) update(webhook *db.QueuedWebhook) {
+	err := database.UpdateWebhook(webhook)
+	if err != nil {
+		log.Printf("queue: unable to update webhook %d: %v", webhook.Id, err)
+	}
+}
+
+// Run the add or remove action for a stored webhook payload
+func processWebhook(payload []byte) error {
+	var webhookRequest webhookBody
+	err := json.Unmarshal(payload, &webhookRequest)
+	if err != nil {
+		return err
+	}
+
+	linked, err := requestedFromList(webhookRequest)
+	if err != nil {
+		return err
+	}
+
+	// Requests the poller made came from a trakt list, sending them to trakt would echo them onto the requester's lists
+	if linked {
+		log.Printf("queue: skipping %s notification for request %s as it was requested from a trakt list", webhookRequest.NotificationType, webhookRequest.Request.RequestId)
+		return nil
+	}
+
+	switch notificationAction(webhookRequest.NotificationType) {
+	case actionAdd:
+		return addMedia(webhookRequest)
+
+	case actionRemove:
+		return removeMedia(webhookRequest)
+	}
+
+	return nil
+}
+
+// Check whether a webhook is for a request the list poller made, waits for a request being made to be linked
+func requestedFromList(body webhookBody) (bool, error) {
+	if body.Request == nil || body.Request.RequestId == "" {
+		return false, nil
+	}
+
+	listLinkMutex.Lock()
+	defer listLinkMutex.Unlock()
+
+	link, err := database.FindRequestedListLink(body.Request.RequestId)
+	if err != nil {
+		return false, err
+	}
+
+	return link != nil, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	db "github.com/sjdaws/overtrakt/database"
+	"github.com/sjdaws/overtrakt/trakt"
+)
+
+const (
+	reconcileFixPending = "pending"
+	reconcileFixReadd   = "readd"
+)
+
+// Compare every list requests are routed to with what is actually on trakt, missing requests can be re-added
+// straight away with -fix=readd or left for the unsynced job with -fix=pending
+func reconcile(args []string) bool {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	fix := flags.String("fix", "", "fix missing requests, either readd to add them now or pending to retry them later")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return false
+	}
+
+	if *fix != "" && *fix != reconcileFixReadd && *fix != reconcileFixPending {
+		log.Printf("reconcile: invalid fix %s, expected %s or %s", *fix, reconcileFixReadd, reconcileFixPending)
+		return false
+	}
+
+	requests, err := database.GetTraktRequests()
+	if err != nil {
+		log.Printf("reconcile: %v", err)
+		return false
+	}
+
+	// The default lists are always checked, even if nothing has been requested yet, movies and tv shows may share a
+	// list and either may not be set
+	lists := listsForRequester("")
+	targets := make([]trakt.Target, 0)
+	for _, listId := range []string{lists.MovieListId, lists.TvShowListId} {
+		target := trakt.NewListTarget(lists.UserId, listId)
+		if listId != "" && !containsTarget(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+
+	groups := make(map[trakt.Target][]*db.TraktRequest)
+	for _, request := range requests {
+		for _, target := range targetsForRequest(request) {
+			// Lists which aren't configured can't be read, the request could never have been sent to them either
+			if target.Type() != trakt.TargetList || target.Validate() != nil {
+				continue
+			}
+
+			if _, ok := groups[target]; !ok && !containsTarget(targets, target) {
+				targets = append(targets, target)
+			}
+
+			groups[target] = append(groups[target], request)
+		}
+	}
+
+	success := true
+	for _, target := range targets {
+		report, err := clients.Reconcile(groups[target], target)
+		if err != nil {
+			log.Printf("reconcile: %s: %v", target, err)
+			success = false
+			continue
+		}
+
+		log.Printf("reconcile: %s", report)
+
+		for _, request := range report.Missing {
+			log.Printf("reconcile: %s: missing %s imdb=%s tmdb=%s tvdb=%s requester=%s", target, request.RequestType, request.ImdbId, request.TmdbId, request.TvdbId, request.Requester)
+		}
+
+		for _, extra := range report.Extra {
+			log.Printf("reconcile: %s: extra %s", target, extra)
+		}
+
+		for _, mismatch := range report.Mismatched {
+			log.Printf("reconcile: %s: mismatched %s", target, mismatch.Reason)
+		}
+
+		if !fixMissing(*fix, report) {
+			success = false
+		}
+
+		// Anything left unfixed is a failure so the command can be used in scripts
+		if len(report.Extra) > 0 || len(report.Mismatched) > 0 || (*fix == "" && len(report.Missing) > 0) {
+			success = false
+		}
+	}
+
+	return success
+}
+
+func containsTarget(targets []trakt.Target, target trakt.Target) bool {
+	for _, existing := range targets {
+		if existing == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Re-add or reset missing requests, returns false if any couldn't be fixed
+func fixMissing(fix string, report *trakt.ReconcileReport) bool {
+	success := true
+	for _, request := range report.Missing {
+		var err error
+		switch fix {
+		case reconcileFixPending:
+			err = database.ResetTraktRequest(request)
+
+		case reconcileFixReadd:
+			err = clients.Add(request, []trakt.Target{report.Target})
+
+		default:
+			continue
+		}
+
+		if err != nil {
+			log.Printf("reconcile: %s: unable to fix %s imdb=%s tmdb=%s tvdb=%s: %v", report.Target, request.RequestType, request.ImdbId, request.TmdbId, request.TvdbId, err)
+			success = false
+			continue
+		}
+
+		log.Printf("reconcile: %s: fixed %s imdb=%s tmdb=%s tvdb=%s using %s", report.Target, request.RequestType, request.ImdbId, request.TmdbId, request.TvdbId, fix)
+	}
+
+	return success
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sjdaws/overtrakt/trakt"
+)
+
+var (
+	requesterLists = make(map[string]trakt.UserLists)
+
+	traktMovie4kList    = os.Getenv("TRAKT_MOVIE_4K_LIST")
+	traktRequesterLists = os.Getenv("TRAKT_REQUESTER_LISTS")
+	traktTvShow4kList   = os.Getenv("TRAKT_TVSHOW_4K_LIST")
+)
+
+// Load requester routing from env, entries are space separated in the format
+// overseerr_username:trakt_user:movie_list:tvshow_list[:movie_4k_list:tvshow_4k_list], empty values fall back
+// to the global values
+func loadRequesterLists() error {
+	for _, entry := range strings.Split(traktRequesterLists, " ") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if (len(parts) != 4 && len(parts) != 6) || parts[0] == "" {
+			return fmt.Errorf("invalid TRAKT_REQUESTER_LISTS entry %s, expected overseerr_username:trakt_user:movie_list:tvshow_list[:movie_4k_list:tvshow_4k_list]", entry)
+		}
+
+		lists := trakt.UserLists{
+			MovieListId:  parts[2],
+			TvShowListId: parts[3],
+			UserId:       parts[1],
+		}
+
+		if len(parts) == 6 {
+			lists.Movie4kListId = parts[4]
+			lists.TvShow4kListId = parts[5]
+		}
+
+		requesterLists[strings.ToLower(parts[0])] = lists
+	}
+
+	return nil
+}
+
+// Get the lists for a requester, falling back to the global lists
+func listsForRequester(requester string) trakt.UserLists {
+	lists := requesterLists[strings.ToLower(requester)]
+
+	// 4k lists are optional and the global ones belong to the default account
+	defaultAccount := lists.UserId == "" || strings.EqualFold(lists.UserId, traktUser)
+
+	if lists.Movie4kListId == "" && defaultAccount {
+		lists.Movie4kListId = traktMovie4kList
+	}
+
+	if lists.TvShow4kListId == "" && defaultAccount {
+		lists.TvShow4kListId = traktTvShow4kList
+	}
+
+	if lists.MovieListId == "" {
+		lists.MovieListId = traktMovieList
+	}
+
+	if lists.TvShowListId == "" {
+		lists.TvShowListId = traktTvShowList
+	}
+
+	if lists.UserId == "" {
+		lists.UserId = traktUser
+	}
+
+	return lists
+}
+
+// Get every trakt account which needs to be authorised
+func traktAccounts() []string {
+	accounts := []string{traktUser}
+	for _, lists := range requesterLists {
+		if lists.UserId != "" {
+			accounts = append(accounts, lists.UserId)
+		}
+	}
+
+	accounts = append(accounts, routingAccounts()...)
+	accounts = append(accounts, requestListAccounts()...)
+
+	return accounts
+}
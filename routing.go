@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	db "github.com/sjdaws/overtrakt/database"
+	"github.com/sjdaws/overtrakt/trakt"
+)
+
+// Name reported when no rule matches and the requester's lists are used
+const defaultRouteName = "default"
+
+var (
+	defaultTargetTypes []string
+	routingRules       []routingRule
+
+	routingRulesFile = os.Getenv("ROUTING_RULES")
+	traktTargets     = os.Getenv("TRAKT_TARGETS")
+)
+
+// Every condition which is set must match, a list of values matches if any value matches
+type routingMatch struct {
+	Genre            []string `json:"genre"`
+	Is4k             *bool    `json:"is_4k"`
+	Keyword          []string `json:"keyword"`
+	MediaType        []string `json:"media_type"`
+	NotificationType []string `json:"notification_type"`
+	Requester        []string `json:"requester"`
+}
+
+type routingRule struct {
+	Continue bool            `json:"continue"`
+	Match    routingMatch    `json:"match"`
+	Name     string          `json:"name"`
+	Targets  []routingTarget `json:"targets"`
+}
+
+// An empty user is the requester's trakt account and an empty list is the requester's list for the media type
+type routingTarget struct {
+	List string `json:"list"`
+	Type string `json:"type"`
+	User string `json:"user"`
+}
+
+// Load the targets used when no rule matches from TRAKT_TARGETS, a space separated list of list, watchlist or
+// collection which defaults to the requester's list
+func loadDefaultTargets() error {
+	defaultTargetTypes = make([]string, 0)
+	for _, targetType := range strings.Fields(strings.ToLower(traktTargets)) {
+		_, err := trakt.NewTarget(targetType, "", "")
+		if err != nil {
+			return fmt.Errorf("invalid TRAKT_TARGETS: %v", err)
+		}
+
+		if !containsFold(defaultTargetTypes, targetType) {
+			defaultTargetTypes = append(defaultTargetTypes, targetType)
+		}
+	}
+
+	if len(defaultTargetTypes) == 0 {
+		defaultTargetTypes = []string{trakt.TargetList}
+	}
+
+	return nil
+}
+
+// Load routing rules from the json file in ROUTING_RULES, without rules requests use the default targets
+func loadRoutingRules() error {
+	err := loadDefaultTargets()
+	if err != nil {
+		return err
+	}
+
+	if routingRulesFile == "" {
+		return nil
+	}
+
+	contents, err := os.ReadFile(routingRulesFile)
+	if err != nil {
+		return fmt.Errorf("routing: unable to read ROUTING_RULES: %v", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.DisallowUnknownFields()
+
+	var rules []routingRule
+	err = decoder.Decode(&rules)
+	if err != nil {
+		return fmt.Errorf("routing: unable to parse ROUTING_RULES: %v", err)
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		if len(rule.Targets) == 0 {
+			return fmt.Errorf("routing: %s has no targets", rule.Name)
+		}
+
+		for j, mediaType := range rule.Match.MediaType {
+			rule.Match.MediaType[j] = requestTypeFor(mediaType)
+			if rule.Match.MediaType[j] == "" {
+				return fmt.Errorf("routing: %s has unknown media type %q, expected %s or %s", rule.Name, mediaType, mediaTypeMovie, mediaTypeTvShow)
+			}
+		}
+
+		for j := range rule.Targets {
+			rule.Targets[j].Type = strings.ToLower(strings.TrimSpace(rule.Targets[j].Type))
+			if rule.Targets[j].Type == "" {
+				rule.Targets[j].Type = trakt.TargetList
+			}
+
+			// Users and lists are filled in per request so only the type can be checked here
+			_, err = trakt.NewTarget(rule.Targets[j].Type, "", "")
+			if err != nil {
+				return fmt.Errorf("routing: %s: %v", rule.Name, err)
+			}
+		}
+	}
+
+	routingRules = rules
+
+	return nil
+}
+
+// Work out where a request should be sent, rules are evaluated in order and the first match wins unless it
+// continues, the names of the rules which matched are returned as well
+func routeRequest(request *db.TraktRequest) ([]trakt.Target, []string) {
+	targets := make([]trakt.Target, 0)
+	matched := make([]string, 0)
+	seen := make(map[trakt.Target]bool)
+
+	for _, rule := range routingRules {
+		if !rule.Match.matches(request) {
+			continue
+		}
+
+		matched = append(matched, rule.Name)
+		for _, routing := range rule.Targets {
+			target := routing.resolve(request)
+			if !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+		}
+
+		if !rule.Continue {
+			break
+		}
+	}
+
+	if len(matched) == 0 {
+		return defaultTargets(request), []string{defaultRouteName}
+	}
+
+	return targets, matched
+}
+
+// Work out where a removal should be sent, removals follow the stored request so they reach wherever it was added,
+// routing the removal itself wouldn't match rules written for the notification which added it
+func routeRemoval(request *db.TraktRequest) ([]trakt.Target, []string, error) {
+	stored, err := database.FindTraktRequest(request)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if stored == nil {
+		targets, matched := routeRequest(request)
+		return targets, matched, nil
+	}
+
+	targets, matched := routeStored(stored)
+
+	return targets, matched, nil
+}
+
+// Work out every target a stored request could have been added to. Only the latest notification type is stored and
+// each notification which adds may have been routed somewhere else, so the request is routed as each of them and the
+// targets are combined
+func routeStored(request *db.TraktRequest) ([]trakt.Target, []string) {
+	notificationTypes := make([]string, 0, len(notificationActions))
+	for notificationType, configured := range notificationActions {
+		if configured == actionAdd && !strings.EqualFold(notificationType, request.NotificationType) {
+			notificationTypes = append(notificationTypes, notificationType)
+		}
+	}
+
+	sort.Strings(notificationTypes)
+	notificationTypes = append([]string{request.NotificationType}, notificationTypes...)
+
+	targets := make([]trakt.Target, 0)
+	matched := make([]string, 0)
+	seen := make(map[trakt.Target]bool)
+
+	for _, notificationType := range notificationTypes {
+		routed := *request
+		routed.NotificationType = notificationType
+
+		routedTargets, routedMatched := routeRequest(&routed)
+		for _, target := range routedTargets {
+			if !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+		}
+
+		for _, name := range routedMatched {
+			if !containsFold(matched, name) {
+				matched = append(matched, name)
+			}
+		}
+	}
+
+	return targets, matched
+}
+
+// Send requests to each of the default target types for the requester's account
+func defaultTargets(request *db.TraktRequest) []trakt.Target {
+	targets := make([]trakt.Target, 0, len(defaultTargetTypes))
+	for _, targetType := range defaultTargetTypes {
+		target := routingTarget{Type: targetType}
+		targets = append(targets, target.resolve(request))
+	}
+
+	return targets
+}
+
+// Targets for replaying a stored request
+func targetsForRequest(request *db.TraktRequest) []trakt.Target {
+	targets, _ := routeRequest(request)
+
+	return targets
+}
+
+// Targets for removing a stored request from everywhere it could have been added
+func removalTargetsForRequest(request *db.TraktRequest) []trakt.Target {
+	targets, _ := routeStored(request)
+
+	return targets
+}
+
+// Trakt accounts referenced by routing rules
+func routingAccounts() []string {
+	accounts := make([]string, 0)
+	for _, rule := range routingRules {
+		for _, target := range rule.Targets {
+			if target.User != "" {
+				accounts = append(accounts, target.User)
+			}
+		}
+	}
+
+	return accounts
+}
+
+func (m routingMatch) matches(request *db.TraktRequest) bool {
+	if m.Is4k != nil && *m.Is4k != request.Is4k {
+		return false
+	}
+
+	if len(m.MediaType) > 0 && !containsFold(m.MediaType, request.RequestType) {
+		return false
+	}
+
+	if len(m.NotificationType) > 0 && !containsFold(m.NotificationType, request.NotificationType) {
+		return false
+	}
+
+	if len(m.Requester) > 0 && !containsFold(m.Requester, request.Requester) {
+		return false
+	}
+
+	if len(m.Genre) > 0 && !containsAnyFold(m.Genre, extraValues(request.Extra, "genre", "genres")) {
+		return false
+	}
+
+	if len(m.Keyword) > 0 && !containsAnyFold(m.Keyword, extraValues(request.Extra, "keyword", "keywords")) {
+		return false
+	}
+
+	return true
+}
+
+func (t routingTarget) resolve(request *db.TraktRequest) trakt.Target {
+	lists := listsForRequester(request.Requester)
+
+	account := t.User
+	if account == "" {
+		account = lists.UserId
+	}
+
+	listId := t.List
+	if t.Type == trakt.TargetList && listId == "" {
+		listId = lists.MovieList(request.Is4k)
+		if request.RequestType == trakt.RequestTypeTvShow {
+			listId = lists.TvShowList(request.Is4k)
+		}
+	}
+
+	// The type was checked when the rules were loaded
+	target, _ := trakt.NewTarget(t.Type, account, listId)
+
+	return target
+}
+
+func containsAnyFold(values []string, candidates []string) bool {
+	for _, candidate := range candidates {
+		if containsFold(values, candidate) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), strings.TrimSpace(value)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Comma separated values from stored extra fields with any of the names
+func extraValues(extra string, names ...string) []string {
+	values := make([]string, 0)
+	if extra == "" {
+		return values
+	}
+
+	var extras []webhookExtra
+	err := json.Unmarshal([]byte(extra), &extras)
+	if err != nil {
+		return values
+	}
+
+	for _, field := range extras {
+		if !containsFold(names, field.Name) {
+			continue
+		}
+
+		for _, value := range strings.Split(field.Value, ",") {
+			value = strings.TrimSpace(value)
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+
+	return values
+}
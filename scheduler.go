@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Periodically replays unsynced requests while the server is running
+type unsyncedScheduler struct {
+	done       chan struct{}
+	lastResult string
+	lastRun    time.Time
+	mutex      sync.Mutex
+}
+
+var scheduler = &unsyncedScheduler{
+	done: make(chan struct{}),
+}
+
+// Run until the context is cancelled, a zero interval disables the scheduler
+func (s *unsyncedScheduler) run(ctx context.Context, interval time.Duration) {
+	defer close(s.done)
+
+	if interval <= 0 {
+		return
+	}
+
+	log.Printf("scheduler: replaying unsynced requests every %s", interval)
+
+	for {
+		// Jitter runs by up to 10% so multiple instances don't hit trakt at the same time
+		wait := interval
+		if jitter := int64(interval / 10); jitter > 0 {
+			wait += time.Duration(rand.Int63n(jitter))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		report, err := syncUnsynced()
+		if err != nil {
+			s.record(fmt.Sprintf("error: %v", err))
+			continue
+		}
+
+		s.record(report.Summary())
+	}
+}
+
+// Get the time and result of the last run
+func (s *unsyncedScheduler) status() (time.Time, string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.lastRun, s.lastResult
+}
+
+// Wait for an in progress run to finish
+func (s *unsyncedScheduler) wait() {
+	<-s.done
+}
+
+func (s *unsyncedScheduler) record(result string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastResult = result
+	s.lastRun = time.Now()
+}
@@ -13,6 +13,24 @@ import (
 	db "github.com/sjdaws/overtrakt/database"
 )
 
+type AuthState string
+
+const (
+	AuthStateAuthorised       AuthState = "authorised"
+	AuthStateAwaitingUserCode AuthState = "awaiting user code"
+	AuthStateRefreshFailed    AuthState = "refresh failed"
+	AuthStateUnauthorised     AuthState = "unauthorised"
+)
+
+// AuthStatus is a snapshot of where an account is in the authorisation flow
+type AuthStatus struct {
+	Account         string
+	CodeExpiresAt   time.Time
+	State           AuthState
+	UserCode        string
+	VerificationUrl string
+}
+
 type accessTokenRequest struct {
 	Code         string `json:"code"`
 	ClientId     string `json:"client_id"`
@@ -28,11 +46,21 @@ type accessTokenResponse struct {
 	TokenType    string `json:"token_type"`
 }
 
+type authorisation struct {
+	codeExpiresAt   time.Time
+	deviceCode      string
+	fallback        AuthState
+	state           AuthState
+	userCode        string
+	verificationUrl string
+}
+
 type credentials struct {
 	accessToken  string
+	account      string
 	clientId     string
 	clientSecret string
-	deviceCode   string
+	createdAt    time.Time
 	expiresAt    time.Time
 	refreshToken string
 	tokenType    string
@@ -58,87 +86,164 @@ type refreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-func (c *Client) authenticate() error {
-	if c.credentials.accessToken == "" {
-		traktCredentials, err := c.database.GetTraktAuth(c.credentials.clientId)
-		if err != nil && err != sql.ErrNoRows {
-			return fmt.Errorf("auth: %v", err)
-		}
-
-		if traktCredentials != nil {
-			c.credentials.accessToken = traktCredentials.AccessToken
-			c.credentials.expiresAt = traktCredentials.ExpiresAt
-			c.credentials.refreshToken = traktCredentials.RefreshToken
-			c.credentials.tokenType = traktCredentials.TokenType
-		}
+// AuthStatus returns the current authorisation state of the account
+func (c *Client) AuthStatus() AuthStatus {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return AuthStatus{
+		Account:         c.credentials.account,
+		CodeExpiresAt:   c.authorisation.codeExpiresAt,
+		State:           c.authorisation.state,
+		UserCode:        c.authorisation.userCode,
+		VerificationUrl: c.authorisation.verificationUrl,
 	}
+}
 
-	if c.credentials.expiresAt.After(time.Now()) {
-		return nil
-	}
+// StartAuthorisation requests a device code and polls for the user to enter it in the background,
+// if a code is already awaiting entry it is returned instead
+func (c *Client) StartAuthorisation() (AuthStatus, error) {
+	c.mutex.Lock()
+	awaiting := c.authorisation.state == AuthStateAwaitingUserCode && c.authorisation.codeExpiresAt.After(time.Now())
+	fallback := c.authorisation.settled()
+	c.mutex.Unlock()
 
-	if c.credentials.refreshToken != "" {
-		log.Print("auth: trakt access token has expired, requesting refreshed token")
-		response, err := c.refreshAccessToken(c.credentials.refreshToken)
-		if err == nil {
-			return c.saveAccessToken(response)
-		}
+	if awaiting {
+		return c.AuthStatus(), nil
 	}
 
-	response, err := c.createAccessToken()
+	codeResponse, err := c.getDeviceCode()
 	if err != nil {
-		return fmt.Errorf("auth: %v", err)
+		return c.AuthStatus(), fmt.Errorf("auth: %v", err)
 	}
 
-	return c.saveAccessToken(response)
-}
-
-func (c *Client) createAccessToken() (*accessTokenResponse, error) {
-	codeResponse, err := c.getDeviceCode()
-	if err != nil {
-		return nil, err
+	if codeResponse.DeviceCode == "" {
+		return c.AuthStatus(), fmt.Errorf("auth: trakt did not return a device code")
 	}
 
-	c.credentials.deviceCode = codeResponse.DeviceCode
 	expiresAt := time.Now().Add(time.Duration(codeResponse.ExpiresIn) * time.Second)
 
-	notify.Message(fmt.Sprintf("Action required: authentication requires intervention.\n\nURL: %s\nCode: %s", codeResponse.VerificationUrl, codeResponse.UserCode))
+	c.mutex.Lock()
+	c.authorisation = authorisation{
+		codeExpiresAt:   expiresAt,
+		deviceCode:      codeResponse.DeviceCode,
+		fallback:        fallback,
+		state:           AuthStateAwaitingUserCode,
+		userCode:        codeResponse.UserCode,
+		verificationUrl: codeResponse.VerificationUrl,
+	}
+	c.mutex.Unlock()
+
+	notify.Message(fmt.Sprintf("Action required: authentication for trakt account %s requires intervention.\n\nURL: %s\nCode: %s", c.credentials.account, codeResponse.VerificationUrl, codeResponse.UserCode))
 	log.Print("******************************** ACTION REQUIRED ********************************")
 	log.Print("*                                                                               *")
+	log.Printf("* Trakt account: %-62s *", c.credentials.account)
+	log.Print("*                                                                               *")
 	log.Printf("* Please go to %s and enter the following code: %s *", codeResponse.VerificationUrl, codeResponse.UserCode)
 	log.Print("*                                                                               *")
 	log.Printf("* Code will expire at %s                           *", expiresAt.Format(time.RFC822))
 	log.Print("*                                                                               *")
 	log.Print("*********************************************************************************")
 
-	for {
-		if time.Now().After(expiresAt) {
-			return nil, fmt.Errorf("auth: unable to fetch trakt access token within allowed time limit")
-		}
+	go c.pollAccessToken(codeResponse.DeviceCode, time.Duration(codeResponse.Interval)*time.Second, expiresAt)
 
-		// log.Printf("auth: waiting for authorisation for code: %s", codeResponse.UserCode)
+	return c.AuthStatus(), nil
+}
+
+// Only refreshes tokens, device code authorisation must be started explicitly
+func (c *Client) authenticate() error {
+	// Wait for stored credentials to be loaded
+	<-c.ready
+
+	return c.refresh()
+}
+
+// Load stored credentials and refresh or request authorisation if required
+func (c *Client) initialise() {
+	defer close(c.ready)
+
+	traktCredentials, err := c.database.GetTraktAuth(c.credentials.clientId, c.credentials.account)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("auth: unable to load credentials for %s: %v", c.credentials.account, err)
+	}
+
+	if traktCredentials != nil {
+		c.mutex.Lock()
+		c.credentials.accessToken = traktCredentials.AccessToken
+		c.credentials.createdAt = traktCredentials.CreatedAt
+		c.credentials.expiresAt = traktCredentials.ExpiresAt
+		c.credentials.refreshToken = traktCredentials.RefreshToken
+		c.credentials.tokenType = traktCredentials.TokenType
+		c.mutex.Unlock()
 
-		tokenResponse, err := c.getAccessToken()
+		err = c.refresh()
 		if err != nil {
-			return nil, err
+			log.Print(err)
+		} else {
+			c.mutex.Lock()
+			c.setAuthState(AuthStateAuthorised)
+			c.mutex.Unlock()
 		}
 
-		if len(tokenResponse.AccessToken) == 0 {
-			time.Sleep(time.Duration(codeResponse.Interval) * time.Second)
-			continue
-		}
+		return
+	}
+
+	_, err = c.StartAuthorisation()
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// Refresh the access token if it has expired, the lock isn't held while trakt is called so status checks and other
+// requests aren't blocked by retries
+func (c *Client) refresh() error {
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+
+	c.mutex.Lock()
+	valid := c.credentials.accessToken != "" && c.credentials.expiresAt.After(time.Now())
+	refreshToken := c.credentials.refreshToken
+	state := c.authorisation.settled()
+	c.mutex.Unlock()
+
+	if valid {
+		return nil
+	}
+
+	// Once a refresh has failed a new authorisation is required
+	if refreshToken == "" || state == AuthStateRefreshFailed {
+		return fmt.Errorf("auth: trakt account %s is %s", c.credentials.account, state)
+	}
+
+	log.Printf("auth: trakt access token for %s has expired, requesting refreshed token", c.credentials.account)
+	response, err := c.refreshAccessToken(refreshToken)
+	if err != nil {
+		c.mutex.Lock()
+		c.setAuthState(AuthStateRefreshFailed)
+		c.mutex.Unlock()
 
-		log.Print("auth: authorised")
+		notify.Message(fmt.Sprintf("Action required: unable to refresh trakt access token for %s, authorisation must be restarted: %v", c.credentials.account, err))
 
-		return tokenResponse, nil
+		return fmt.Errorf("auth: unable to refresh access token for %s: %v", c.credentials.account, err)
 	}
+
+	c.mutex.Lock()
+	c.setAuthState(AuthStateAuthorised)
+	err = c.saveAccessToken(response)
+	c.mutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("auth: %v", err)
+	}
+
+	return nil
 }
 
-func (c *Client) getAccessToken() (*accessTokenResponse, error) {
+func (c *Client) getAccessToken(deviceCode string) (*accessTokenResponse, error) {
 	httpResponse, err := c.doRequest(requestParameters{
 		auth: false,
 		body: accessTokenRequest{
-			Code:         c.credentials.deviceCode,
+			Code:         deviceCode,
 			ClientId:     c.credentials.clientId,
 			ClientSecret: c.credentials.clientSecret,
 		},
@@ -186,6 +291,52 @@ func (c *Client) getDeviceCode() (*deviceCodeResponse, error) {
 	return &response, nil
 }
 
+// Poll until the user code is entered or expires, a newer flow supersedes this one
+func (c *Client) pollAccessToken(deviceCode string, interval time.Duration, expiresAt time.Time) {
+	for {
+		c.mutex.Lock()
+		superseded := c.authorisation.deviceCode != deviceCode
+		c.mutex.Unlock()
+
+		if superseded {
+			return
+		}
+
+		if time.Now().After(expiresAt) {
+			log.Printf("auth: unable to fetch trakt access token for %s within allowed time limit", c.credentials.account)
+			c.resetAuthorisation(deviceCode)
+			return
+		}
+
+		tokenResponse, err := c.getAccessToken(deviceCode)
+		if err != nil {
+			log.Printf("auth: %v", err)
+			c.resetAuthorisation(deviceCode)
+			return
+		}
+
+		if len(tokenResponse.AccessToken) == 0 {
+			time.Sleep(interval)
+			continue
+		}
+
+		c.mutex.Lock()
+		c.authorisation = authorisation{
+			state: AuthStateAuthorised,
+		}
+		err = c.saveAccessToken(tokenResponse)
+		c.mutex.Unlock()
+
+		if err != nil {
+			log.Printf("auth: unable to save access token for %s: %v", c.credentials.account, err)
+		}
+
+		log.Printf("auth: %s authorised", c.credentials.account)
+
+		return
+	}
+}
+
 func (c *Client) refreshAccessToken(refreshToken string) (*accessTokenResponse, error) {
 	httpResponse, err := c.doRequest(requestParameters{
 		auth: false,
@@ -205,26 +356,73 @@ func (c *Client) refreshAccessToken(refreshToken string) (*accessTokenResponse,
 
 	defer c.close(httpResponse.Body)
 
+	if httpResponse.StatusCode != 200 {
+		return nil, fmt.Errorf("trakt responded with status %d", httpResponse.StatusCode)
+	}
+
 	var response accessTokenResponse
-	if httpResponse.StatusCode == 200 {
-		err = json.NewDecoder(httpResponse.Body).Decode(&response)
-		if err != nil {
-			return nil, err
-		}
+	err = json.NewDecoder(httpResponse.Body).Decode(&response)
+	if err != nil {
+		return nil, err
 	}
 
 	return &response, nil
 }
 
+// Return to the state before the flow for a device code started if it's still the current one, an account which was
+// authorised stays authorised when a code expires or is denied
+func (c *Client) resetAuthorisation(deviceCode string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.authorisation.deviceCode != deviceCode {
+		return
+	}
+
+	c.authorisation = authorisation{
+		state: c.authorisation.settled(),
+	}
+}
+
+// Must be called with the mutex held, a flow awaiting a user code is left alone so the code is still shown and the
+// state is applied if the flow ends without a token
+func (c *Client) setAuthState(state AuthState) {
+	if c.authorisation.state == AuthStateAwaitingUserCode {
+		c.authorisation.fallback = state
+		return
+	}
+
+	c.authorisation.state = state
+}
+
+// The state of the stored credentials, ignoring any flow awaiting a user code
+func (a authorisation) settled() AuthState {
+	if a.state != AuthStateAwaitingUserCode {
+		return a.state
+	}
+
+	if a.fallback == "" {
+		return AuthStateUnauthorised
+	}
+
+	return a.fallback
+}
+
+// Must be called with the mutex held
 func (c *Client) saveAccessToken(response *accessTokenResponse) error {
 	c.credentials.accessToken = response.AccessToken
+	c.credentials.createdAt = time.Unix(int64(response.CreatedAt), 0)
+	c.credentials.expiresAt = time.Unix(int64(response.CreatedAt)+int64(response.ExpiresIn), 0)
+	c.credentials.refreshToken = response.RefreshToken
 	c.credentials.tokenType = response.TokenType
 
 	return c.database.SetTraktAuth(&db.TraktCredentials{
 		ClientId:     c.credentials.clientId,
+		Account:      c.credentials.account,
 		AccessToken:  c.credentials.accessToken,
-		RefreshToken: response.RefreshToken,
-		TokenType:    response.TokenType,
-		ExpiresAt:    time.Unix(int64(response.CreatedAt)+int64(response.ExpiresIn), 0),
+		RefreshToken: c.credentials.refreshToken,
+		TokenType:    c.credentials.tokenType,
+		CreatedAt:    c.credentials.createdAt,
+		ExpiresAt:    c.credentials.expiresAt,
 	})
 }
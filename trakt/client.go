@@ -7,15 +7,23 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	db "github.com/sjdaws/overtrakt/database"
 )
 
 type Client struct {
-	credentials credentials
-	database    *db.Database
-	httpClient  *http.Client
+	authorisation  authorisation
+	credentials    credentials
+	database       *db.Database
+	httpClient     *http.Client
+	mutex          sync.Mutex
+	rateLimit      rateLimit
+	ready          chan struct{}
+	refreshMutex   sync.Mutex
+	seasonRequests bool
 }
 
 type requestParameters struct {
@@ -25,15 +33,25 @@ type requestParameters struct {
 	path   string
 }
 
-const apiUrl = "https://api.trakt.tv"
+const (
+	apiUrl             = "https://api.trakt.tv"
+	requestMaxAttempts = 4
+	requestMaxWait     = 5 * time.Minute
+	requestMinBackoff  = time.Second
+)
 
-func NewClient(clientId string, clientSecret string, database *db.Database) *Client {
+func NewClient(clientId string, clientSecret string, account string, database *db.Database) *Client {
 	client := &Client{
+		authorisation: authorisation{
+			state: AuthStateUnauthorised,
+		},
 		credentials: credentials{
+			account:      account,
 			clientId:     clientId,
 			clientSecret: clientSecret,
 		},
 		database: database,
+		ready:    make(chan struct{}),
 		httpClient: &http.Client{
 			Timeout: 120 * time.Second,
 			Transport: &http.Transport{
@@ -42,16 +60,22 @@ func NewClient(clientId string, clientSecret string, database *db.Database) *Cli
 		},
 	}
 
-	err := client.authenticate()
-	if err != nil {
-		log.Print(err)
-	}
+	// Authorisation may require user interaction so it can't block startup
+	go client.initialise()
 
 	return client
 }
 
+func (c *Client) Account() string {
+	return c.credentials.account
+}
+
+// Health is true while the stored credentials are usable, even if a new authorisation has been started
 func (c *Client) Health() bool {
-	return c.credentials.accessToken != ""
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.authorisation.settled() == AuthStateAuthorised
 }
 
 func (c *Client) close(body io.ReadCloser) {
@@ -62,48 +86,128 @@ func (c *Client) close(body io.ReadCloser) {
 }
 
 func (c *Client) doRequest(parameters requestParameters) (*http.Response, error) {
-	request, err := http.NewRequest(parameters.method, fmt.Sprintf("%s%s", apiUrl, parameters.path), nil)
-	if err != nil {
-		return nil, err
+	var body []byte
+	if parameters.body != nil {
+		var err error
+		body, err = json.Marshal(parameters.body)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	request.Header.Add("Accept", "application/json")
+	backoff := requestMinBackoff
 
-	if parameters.body != nil {
-		request.Header.Add("Content-Type", "application/json")
-		body, err := json.Marshal(parameters.body)
+	for attempt := 1; ; attempt++ {
+		err := c.waitForRateLimit()
 		if err != nil {
 			return nil, err
 		}
-		request.Body = io.NopCloser(bytes.NewReader(body))
+
+		response, err := c.sendRequest(parameters, body)
+		if err != nil {
+			if attempt >= requestMaxAttempts {
+				return nil, &ApiError{Message: err.Error(), Temporary: true}
+			}
+
+			log.Printf("trakt: request to %s failed, retrying in %s: %v", parameters.path, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+			continue
+		}
+
+		c.updateRateLimit(response)
+
+		if response.StatusCode != 429 && response.StatusCode < 500 {
+			return response, nil
+		}
+
+		wait := backoff
+		if response.StatusCode == 429 && retryAfter(response) > 0 {
+			wait = retryAfter(response)
+		}
+
+		// Give up and let the caller decide what to do with the response
+		if attempt >= requestMaxAttempts || wait > requestMaxWait {
+			return response, nil
+		}
+
+		c.close(response.Body)
+
+		log.Printf("trakt: request to %s responded with status %d, retrying in %s", parameters.path, response.StatusCode, wait)
+		time.Sleep(wait)
+		backoff *= 2
 	}
+}
 
-	request.URL.RawQuery = request.URL.Query().Encode()
+func (c *Client) queryApi(parameters requestParameters) (*http.Response, error) {
+	err := c.authenticate()
+	if err != nil {
+		return nil, &ApiError{Message: err.Error(), StatusCode: 401, Temporary: true}
+	}
 
-	if parameters.auth {
-		request.Header.Add("Authorization", fmt.Sprintf("%s %s", c.credentials.tokenType, c.credentials.accessToken))
-		request.Header.Add("trakt-api-key", c.credentials.clientId)
-		request.Header.Add("trakt-api-version", "2")
+	parameters.auth = true
+	if parameters.method == "" {
+		parameters.method = http.MethodPost
 	}
 
-	response, err := c.httpClient.Do(request)
+	response, err := c.doRequest(parameters)
 	if err != nil {
 		return nil, err
 	}
 
+	// Token may have been revoked or expired early, renew and try once more
+	if response.StatusCode == 401 {
+		c.close(response.Body)
+
+		err = c.renew()
+		if err != nil {
+			return nil, &ApiError{Message: fmt.Sprintf("unable to renew access token: %v", err), StatusCode: 401, Temporary: true}
+		}
+
+		response, err = c.doRequest(parameters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if response.StatusCode >= 400 {
+		defer c.close(response.Body)
+
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+
+		return nil, &ApiError{
+			Message:    strings.TrimSpace(string(message)),
+			RetryAfter: retryAfter(response),
+			StatusCode: response.StatusCode,
+			Temporary:  temporaryStatus(response.StatusCode),
+		}
+	}
+
 	return response, nil
 }
 
-func (c *Client) queryApi(parameters requestParameters) (*http.Response, error) {
-	err := c.authenticate()
+func (c *Client) sendRequest(parameters requestParameters, body []byte) (*http.Response, error) {
+	request, err := http.NewRequest(parameters.method, fmt.Sprintf("%s%s", apiUrl, parameters.path), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	parameters.auth = true
-	if parameters.method == "" {
-		parameters.method = http.MethodPost
+	request.Header.Add("Accept", "application/json")
+
+	if body != nil {
+		request.Header.Add("Content-Type", "application/json")
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	request.URL.RawQuery = request.URL.Query().Encode()
+
+	if parameters.auth {
+		c.mutex.Lock()
+		request.Header.Add("Authorization", fmt.Sprintf("%s %s", c.credentials.tokenType, c.credentials.accessToken))
+		c.mutex.Unlock()
+		request.Header.Add("trakt-api-key", c.credentials.clientId)
+		request.Header.Add("trakt-api-version", "2")
 	}
 
-	return c.doRequest(parameters)
+	return c.httpClient.Do(request)
 }
@@ -0,0 +1,52 @@
+package trakt
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ApiError is returned when trakt responds with an error status or can't be reached
+type ApiError struct {
+	Message    string
+	RetryAfter time.Duration
+	StatusCode int
+	Temporary  bool
+}
+
+func (e *ApiError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("trakt unavailable: %s", e.Message)
+	}
+
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("trakt responded with status %d, retry after %s: %s", e.StatusCode, e.RetryAfter, e.Message)
+	}
+
+	return fmt.Sprintf("trakt responded with status %d: %s", e.StatusCode, e.Message)
+}
+
+// IsTemporary reports whether a request may succeed if retried later
+func IsTemporary(err error) bool {
+	var apiError *ApiError
+	if errors.As(err, &apiError) {
+		return apiError.Temporary
+	}
+
+	return false
+}
+
+// RetryAfter returns how long trakt has asked us to wait, if at all
+func RetryAfter(err error) time.Duration {
+	var apiError *ApiError
+	if errors.As(err, &apiError) {
+		return apiError.RetryAfter
+	}
+
+	return 0
+}
+
+// Statuses which may succeed on a later attempt
+func temporaryStatus(statusCode int) bool {
+	return statusCode == 401 || statusCode == 429 || statusCode >= 500
+}
@@ -0,0 +1,155 @@
+package trakt
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Number of list items requested per page
+const listPageSize = 100
+
+// ListItem is a movie or tv show on a list, seasons are only set if the show was listed by season
+type ListItem struct {
+	ImdbId    string
+	MediaType string
+	Seasons   []int
+	Title     string
+	TmdbId    string
+	TraktId   string
+	TvdbId    string
+	Year      int
+}
+
+type listItem struct {
+	Movie  *searchMedia `json:"movie"`
+	Season *struct {
+		Number int `json:"number"`
+	} `json:"season"`
+	Show *searchMedia `json:"show"`
+	Type string       `json:"type"`
+}
+
+// A movie or show on a list along with any seasons which were listed separately
+type listEntry struct {
+	matched bool
+	media   *searchMedia
+	seasons []int
+	whole   bool
+}
+
+// ListItems gets every movie and tv show on a list
+func (r *Registry) ListItems(target Target) ([]ListItem, error) {
+	client, err := r.Client(target.Account())
+	if err != nil {
+		return nil, err
+	}
+
+	movies, shows, err := client.listItems(target)
+	if err != nil {
+		return nil, fmt.Errorf("list_items: %w", err)
+	}
+
+	items := make([]ListItem, 0, len(movies)+len(shows))
+	for _, entry := range movies {
+		items = append(items, entry.item(RequestTypeMovie))
+	}
+
+	for _, entry := range shows {
+		items = append(items, entry.item(RequestTypeTvShow))
+	}
+
+	return items, nil
+}
+
+// Page through every item on a list, seasons are grouped under their show
+func (c *Client) listItems(target Target) ([]*listEntry, []*listEntry, error) {
+	list, ok := target.(listTarget)
+	if !ok {
+		return nil, nil, fmt.Errorf("list_items: only lists can be read, %s is not a list", target)
+	}
+
+	movies := make([]*listEntry, 0)
+	shows := make([]*listEntry, 0)
+	showsByTraktId := make(map[json.Number]*listEntry)
+
+	for page := 1; ; page++ {
+		httpResponse, err := c.queryApi(requestParameters{
+			method: http.MethodGet,
+			path:   fmt.Sprintf("/users/%s/lists/%s/items?page=%d&limit=%d", list.account, list.listId, page, listPageSize),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var items []listItem
+		err = json.NewDecoder(httpResponse.Body).Decode(&items)
+		c.close(httpResponse.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, item := range items {
+			switch {
+			case item.Type == RequestTypeMovie && item.Movie != nil:
+				c.cacheMedia(RequestTypeMovie, item.Movie)
+				movies = append(movies, &listEntry{media: item.Movie, whole: true})
+
+			case item.Show != nil:
+				entry, ok := showsByTraktId[item.Show.Ids.Trakt]
+				if !ok {
+					// Seasons repeat their show, it only needs caching once
+					c.cacheMedia(RequestTypeTvShow, item.Show)
+					entry = &listEntry{media: item.Show}
+					showsByTraktId[item.Show.Ids.Trakt] = entry
+					shows = append(shows, entry)
+				}
+
+				if item.Type == "season" && item.Season != nil {
+					entry.seasons = append(entry.seasons, item.Season.Number)
+				} else {
+					entry.whole = true
+				}
+			}
+		}
+
+		pageCount, err := strconv.Atoi(httpResponse.Header.Get("X-Pagination-Page-Count"))
+		if err != nil || page >= pageCount || len(items) == 0 {
+			break
+		}
+	}
+
+	return movies, shows, nil
+}
+
+func (e *listEntry) label() string {
+	label := e.media.Title
+	if e.media.Year > 0 {
+		label = fmt.Sprintf("%s (%d)", e.media.Title, e.media.Year)
+	}
+
+	if !e.whole && len(e.seasons) > 0 {
+		label += " (seasons " + joinSeasons(e.seasons) + ")"
+	}
+
+	return label
+}
+
+func (e *listEntry) item(mediaType string) ListItem {
+	item := ListItem{
+		ImdbId:    e.media.Ids.Imdb,
+		MediaType: mediaType,
+		Title:     e.media.Title,
+		TmdbId:    e.media.Ids.Tmdb.String(),
+		TraktId:   e.media.Ids.Trakt.String(),
+		TvdbId:    e.media.Ids.Tvdb.String(),
+		Year:      e.media.Year,
+	}
+
+	if !e.whole {
+		item.Seasons = sortSeasons(e.seasons)
+	}
+
+	return item
+}
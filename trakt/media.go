@@ -0,0 +1,62 @@
+package trakt
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	db "github.com/sjdaws/overtrakt/database"
+)
+
+// Store trakt's details for media so later requests can use its trakt id and title
+func (c *Client) cacheMedia(mediaType string, result *searchMedia) *db.Media {
+	media := &db.Media{
+		MediaType: mediaType,
+		TraktId:   result.Ids.Trakt.String(),
+		Slug:      result.Ids.Slug,
+		Title:     result.Title,
+		Year:      result.Year,
+		ImdbId:    result.Ids.Imdb,
+		TmdbId:    result.Ids.Tmdb.String(),
+		TvdbId:    result.Ids.Tvdb.String(),
+	}
+
+	err := c.database.SaveMedia(media)
+	if err != nil {
+		log.Printf("media: unable to cache %s %s: %v", mediaType, media.TraktId, err)
+	}
+
+	return media
+}
+
+// Get cached details for media, trakt is only searched when it can't match external ids so this never calls trakt
+func (c *Client) lookupMedia(mediaType string, imdbId string, tmdbId string, tvdbId string) *db.Media {
+	media, err := c.database.FindMedia(mediaType, imdbId, tmdbId, tvdbId)
+	if err != nil {
+		log.Printf("media: unable to read cache: %v", err)
+	}
+
+	return media
+}
+
+// Describe media by title if it is known, otherwise by its ids
+func mediaLabel(media *db.Media, ids fmt.Stringer) string {
+	if media == nil || media.Title == "" {
+		return ids.String()
+	}
+
+	if media.Year > 0 {
+		return fmt.Sprintf("%s (%d)", media.Title, media.Year)
+	}
+
+	return media.Title
+}
+
+// Trakt id for cached media, empty if it isn't cached
+func traktIdFor(media *db.Media) json.Number {
+	if media == nil {
+		return ""
+	}
+
+	return json.Number(media.TraktId)
+}
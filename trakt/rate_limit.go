@@ -0,0 +1,77 @@
+package trakt
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type rateLimit struct {
+	mutex sync.Mutex
+	until time.Time
+}
+
+type rateLimitHeader struct {
+	Limit     int    `json:"limit"`
+	Name      string `json:"name"`
+	Period    int    `json:"period"`
+	Remaining int    `json:"remaining"`
+	Until     string `json:"until"`
+}
+
+// Record when the rate limit resets if there are no requests remaining
+func (c *Client) updateRateLimit(response *http.Response) {
+	var header rateLimitHeader
+	err := json.Unmarshal([]byte(response.Header.Get("X-Ratelimit")), &header)
+	if err != nil || header.Remaining > 0 {
+		return
+	}
+
+	until, err := time.Parse(time.RFC3339, header.Until)
+	if err != nil {
+		return
+	}
+
+	c.rateLimit.mutex.Lock()
+	c.rateLimit.until = until
+	c.rateLimit.mutex.Unlock()
+}
+
+// Wait for the rate limit to reset, or fail if that would take too long
+func (c *Client) waitForRateLimit() error {
+	c.rateLimit.mutex.Lock()
+	until := c.rateLimit.until
+	c.rateLimit.mutex.Unlock()
+
+	wait := time.Until(until)
+
+	if wait <= 0 {
+		return nil
+	}
+
+	if wait > requestMaxWait {
+		return &ApiError{
+			Message:    fmt.Sprintf("rate limit exceeded until %s", until.Format(time.RFC822)),
+			RetryAfter: wait,
+			StatusCode: 429,
+			Temporary:  true,
+		}
+	}
+
+	time.Sleep(wait)
+
+	return nil
+}
+
+// Get the wait requested by trakt from the Retry-After header, zero if there isn't one
+func retryAfter(response *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(response.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,149 @@
+package trakt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	db "github.com/sjdaws/overtrakt/database"
+)
+
+// ReconcileReport lists the differences between stored requests and what is actually on a trakt list
+type ReconcileReport struct {
+	Extra      []string
+	Mismatched []ReconcileMismatch
+	Missing    []*db.TraktRequest
+	Target     Target
+}
+
+// ReconcileMismatch is a request which is on the list but doesn't agree with what was recorded
+type ReconcileMismatch struct {
+	Reason  string
+	Request *db.TraktRequest
+}
+
+// Reconcile compares requests routed to a list with the items on it, synced requests should be on the list and
+// anything else should not be
+func (r *Registry) Reconcile(requests []*db.TraktRequest, target Target) (*ReconcileReport, error) {
+	client, err := r.Client(target.Account())
+	if err != nil {
+		return nil, err
+	}
+
+	movies, shows, err := client.listItems(target)
+	if err != nil {
+		return nil, fmt.Errorf("reconcile: %w", err)
+	}
+
+	report := &ReconcileReport{
+		Extra:      make([]string, 0),
+		Mismatched: make([]ReconcileMismatch, 0),
+		Missing:    make([]*db.TraktRequest, 0),
+		Target:     target,
+	}
+
+	for _, request := range requests {
+		var entry *listEntry
+		var label string
+
+		switch request.RequestType {
+		case RequestTypeMovie:
+			media := client.lookupMedia(RequestTypeMovie, request.ImdbId, request.TmdbId, "")
+			ids := movieIdFor(request.ImdbId, request.TmdbId)
+			ids.TraktId = traktIdFor(media)
+			entry = findMovie(movies, ids)
+			label = "movie " + mediaLabel(media, ids)
+
+		case RequestTypeTvShow:
+			media := client.lookupMedia(RequestTypeTvShow, request.ImdbId, "", request.TvdbId)
+			ids := showIdFor(request.ImdbId, request.TvdbId)
+			ids.TraktId = traktIdFor(media)
+			entry = findShow(shows, ids)
+			label = "tv show " + mediaLabel(media, ids)
+
+		default:
+			continue
+		}
+
+		if entry == nil {
+			if request.Status == db.RequestStatusSynced {
+				report.Missing = append(report.Missing, request)
+			}
+			continue
+		}
+
+		entry.matched = true
+
+		if request.Status != db.RequestStatusSynced {
+			report.Mismatched = append(report.Mismatched, ReconcileMismatch{
+				Reason:  fmt.Sprintf("%s is on the list but is recorded as %s", label, request.Status),
+				Request: request,
+			})
+			continue
+		}
+
+		if client.seasonRequests && request.RequestType == RequestTypeTvShow && !entry.whole && !sameSeasons(entry.seasons, request.Seasons) {
+			report.Mismatched = append(report.Mismatched, ReconcileMismatch{
+				Reason:  fmt.Sprintf("%s has seasons %s on the list but seasons %s were requested", label, joinSeasons(entry.seasons), joinSeasons(request.Seasons)),
+				Request: request,
+			})
+		}
+	}
+
+	for _, entry := range movies {
+		if !entry.matched {
+			report.Extra = append(report.Extra, "movie "+entry.label())
+		}
+	}
+
+	for _, entry := range shows {
+		if !entry.matched {
+			report.Extra = append(report.Extra, "tv show "+entry.label())
+		}
+	}
+
+	return report, nil
+}
+
+func (r *ReconcileReport) String() string {
+	return fmt.Sprintf("%s: %d missing, %d extra, %d mismatched", r.Target, len(r.Missing), len(r.Extra), len(r.Mismatched))
+}
+
+func findMovie(entries []*listEntry, ids movieId) *listEntry {
+	for _, entry := range entries {
+		listed := movieId{ImdbId: entry.media.Ids.Imdb, TmdbId: entry.media.Ids.Tmdb, TraktId: entry.media.Ids.Trakt}
+		if listed.matches(ids) {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+func findShow(entries []*listEntry, ids showId) *listEntry {
+	for _, entry := range entries {
+		listed := showId{ImdbId: entry.media.Ids.Imdb, TraktId: entry.media.Ids.Trakt, TvdbId: entry.media.Ids.Tvdb}
+		if listed.matches(ids) {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+func joinSeasons(seasons []int) string {
+	if len(seasons) == 0 {
+		return "none"
+	}
+
+	numbers := make([]string, 0, len(seasons))
+	for _, season := range sortSeasons(seasons) {
+		numbers = append(numbers, strconv.Itoa(season))
+	}
+
+	return strings.Join(numbers, ", ")
+}
+
+func sameSeasons(a []int, b []int) bool {
+	return joinSeasons(a) == joinSeasons(b)
+}
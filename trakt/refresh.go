@@ -0,0 +1,178 @@
+package trakt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sjdaws/overtrakt/notify"
+)
+
+const (
+	refreshMaxBackoff   = 6 * time.Hour
+	refreshMinBackoff   = time.Minute
+	refreshMinInterval  = time.Hour
+	refreshPollInterval = time.Minute
+	refreshWarnInterval = 24 * time.Hour
+)
+
+// RefreshOptions control when the background refresher renews tokens and warns about expiry
+type RefreshOptions struct {
+	Before               time.Duration
+	RefreshTokenLifetime time.Duration
+	WarnBefore           time.Duration
+}
+
+// Validate rejects options which would renew as soon as a token is issued
+func (o RefreshOptions) Validate() error {
+	if o.Before < 0 || o.RefreshTokenLifetime < 0 || o.WarnBefore < 0 {
+		return fmt.Errorf("refresh: durations can't be negative")
+	}
+
+	if o.RefreshTokenLifetime > 0 && o.WarnBefore+refreshMinInterval > o.RefreshTokenLifetime {
+		return fmt.Errorf("refresh: warning %s before a refresh token lifetime of %s leaves less than %s between renewals", o.WarnBefore, o.RefreshTokenLifetime, refreshMinInterval)
+	}
+
+	return nil
+}
+
+// StartRefresher renews the access token for every account ahead of expiry until the context is cancelled
+func (r *Registry) StartRefresher(ctx context.Context, options RefreshOptions) {
+	for _, client := range r.Clients() {
+		go client.refresher(ctx, options)
+	}
+}
+
+func (c *Client) refresher(ctx context.Context, options RefreshOptions) {
+	select {
+	case <-c.ready:
+	case <-ctx.Done():
+		return
+	}
+
+	var backoff time.Duration
+	var warnedAt time.Time
+
+	for {
+		c.mutex.Lock()
+		createdAt := c.credentials.createdAt
+		expiresAt := c.credentials.expiresAt
+		refreshToken := c.credentials.refreshToken
+		c.mutex.Unlock()
+
+		wait := time.Until(options.renewAt(createdAt, expiresAt))
+
+		switch {
+		case refreshToken == "":
+			// Nothing to refresh until the account has been authorised
+			wait = refreshPollInterval
+
+		case backoff > 0:
+			wait = backoff
+		}
+
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+
+		if refreshToken == "" {
+			continue
+		}
+
+		// Tokens may have been renewed elsewhere while waiting
+		c.mutex.Lock()
+		due := !options.renewAt(c.credentials.createdAt, c.credentials.expiresAt).After(time.Now())
+		c.mutex.Unlock()
+
+		if !due {
+			backoff = 0
+			continue
+		}
+
+		err := c.renew()
+		if err == nil {
+			log.Printf("auth: renewed trakt access token for %s", c.credentials.account)
+			backoff = 0
+			warnedAt = time.Time{}
+			continue
+		}
+
+		backoff = nextBackoff(backoff)
+		log.Printf("auth: unable to renew trakt access token for %s, retrying in %s: %v", c.credentials.account, backoff, err)
+
+		unusableAt := createdAt.Add(options.RefreshTokenLifetime)
+		if time.Until(unusableAt) <= options.WarnBefore && time.Since(warnedAt) > refreshWarnInterval {
+			notify.Message(fmt.Sprintf("Warning: unable to renew trakt access token for %s, authorisation will stop working at %s unless renewal succeeds: %v", c.credentials.account, unusableAt.Format(time.RFC822), err))
+			warnedAt = time.Now()
+		}
+	}
+}
+
+// Refresh the access token regardless of whether it has expired, like refresh the lock isn't held while trakt is
+// called
+func (c *Client) renew() error {
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+
+	c.mutex.Lock()
+	refreshToken := c.credentials.refreshToken
+	c.mutex.Unlock()
+
+	response, err := c.refreshAccessToken(refreshToken)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err != nil {
+		// A failure is only fatal once the current token is no longer usable
+		if !c.credentials.expiresAt.After(time.Now()) {
+			c.setAuthState(AuthStateRefreshFailed)
+		}
+
+		return err
+	}
+
+	c.setAuthState(AuthStateAuthorised)
+
+	return c.saveAccessToken(response)
+}
+
+// When renewal should start, trakt issues both tokens together so the access token usually expires around when the
+// refresh token stops working, renewing from WarnBefore means a failure is warned about while there is still time.
+// Renewal never starts sooner than refreshMinInterval after a token was issued, the access token lifetime is set by
+// trakt so a Before longer than it can't be rejected at startup
+func (o RefreshOptions) renewAt(createdAt time.Time, expiresAt time.Time) time.Time {
+	renewAt := expiresAt.Add(-o.Before)
+
+	if o.RefreshTokenLifetime > 0 {
+		warnAt := createdAt.Add(o.RefreshTokenLifetime - o.WarnBefore)
+		if warnAt.Before(renewAt) {
+			renewAt = warnAt
+		}
+	}
+
+	earliest := createdAt.Add(refreshMinInterval)
+	if !createdAt.IsZero() && renewAt.Before(earliest) {
+		return earliest
+	}
+
+	return renewAt
+}
+
+func nextBackoff(backoff time.Duration) time.Duration {
+	if backoff < refreshMinBackoff {
+		return refreshMinBackoff
+	}
+
+	backoff *= 2
+	if backoff > refreshMaxBackoff {
+		return refreshMaxBackoff
+	}
+
+	return backoff
+}
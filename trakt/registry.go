@@ -0,0 +1,95 @@
+package trakt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	db "github.com/sjdaws/overtrakt/database"
+)
+
+// Registry holds an authenticated client for each trakt account
+type Registry struct {
+	clients  map[string]*Client
+	database *db.Database
+}
+
+func NewRegistry(clientId string, clientSecret string, accounts []string, database *db.Database) *Registry {
+	registry := &Registry{
+		clients:  make(map[string]*Client),
+		database: database,
+	}
+
+	for _, account := range accounts {
+		key := strings.ToLower(account)
+		if _, ok := registry.clients[key]; ok {
+			continue
+		}
+
+		registry.clients[key] = NewClient(clientId, clientSecret, account, database)
+	}
+
+	return registry
+}
+
+func (r *Registry) Client(account string) (*Client, error) {
+	client, ok := r.clients[strings.ToLower(account)]
+	if !ok {
+		return nil, fmt.Errorf("registry: trakt account %s is not configured", account)
+	}
+
+	return client, nil
+}
+
+func (r *Registry) Clients() []*Client {
+	clients := make([]*Client, 0, len(r.clients))
+	for _, client := range r.clients {
+		clients = append(clients, client)
+	}
+
+	sort.Slice(clients, func(i int, j int) bool {
+		return clients[i].Account() < clients[j].Account()
+	})
+
+	return clients
+}
+
+// SetSeasonRequests controls whether tv shows are added to lists as the requested seasons rather than the whole show
+func (r *Registry) SetSeasonRequests(enabled bool) {
+	for _, client := range r.clients {
+		client.seasonRequests = enabled
+	}
+}
+
+// NeedsAuthorisation is true if the account is configured but isn't authorised, unknown accounts are left for Client
+// to report. Stored credentials are loaded in the background so this waits for them like authenticate does
+func (r *Registry) NeedsAuthorisation(account string) bool {
+	client, ok := r.clients[strings.ToLower(account)]
+	if !ok {
+		return false
+	}
+
+	<-client.ready
+
+	return !client.Health()
+}
+
+// Health is true only when every account is authorised
+func (r *Registry) Health() bool {
+	for _, client := range r.clients {
+		if !client.Health() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Registry) AuthStatuses() []AuthStatus {
+	statuses := make([]AuthStatus, 0, len(r.clients))
+	for _, client := range r.Clients() {
+		statuses = append(statuses, client.AuthStatus())
+	}
+
+	return statuses
+}
@@ -0,0 +1,110 @@
+package trakt
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+type searchIds struct {
+	Imdb  string      `json:"imdb"`
+	Slug  string      `json:"slug"`
+	Tmdb  json.Number `json:"tmdb"`
+	Trakt json.Number `json:"trakt"`
+	Tvdb  json.Number `json:"tvdb"`
+}
+
+type searchMedia struct {
+	Ids   searchIds `json:"ids"`
+	Title string    `json:"title"`
+	Year  int       `json:"year"`
+}
+
+type searchResult struct {
+	Movie *searchMedia `json:"movie"`
+	Show  *searchMedia `json:"show"`
+	Type  string       `json:"type"`
+}
+
+// Look up a movie's trakt id using each of its external ids in turn
+func (c *Client) resolveMovie(ids movieId) json.Number {
+	media, _ := c.database.FindMedia(RequestTypeMovie, ids.ImdbId, ids.TmdbId.String(), "")
+	if media != nil && json.Number(media.TraktId) != ids.TraktId {
+		return json.Number(media.TraktId)
+	}
+
+	if ids.ImdbId != "" {
+		result, err := c.search("imdb", ids.ImdbId, RequestTypeMovie)
+		if err == nil && result != nil {
+			return result.Ids.Trakt
+		}
+	}
+
+	if ids.TmdbId != "" {
+		result, err := c.search("tmdb", ids.TmdbId.String(), RequestTypeMovie)
+		if err == nil && result != nil {
+			return result.Ids.Trakt
+		}
+	}
+
+	return ""
+}
+
+// Look up a tv show's trakt id using each of its external ids in turn
+func (c *Client) resolveShow(ids showId) json.Number {
+	media, _ := c.database.FindMedia(RequestTypeTvShow, ids.ImdbId, "", ids.TvdbId.String())
+	if media != nil && json.Number(media.TraktId) != ids.TraktId {
+		return json.Number(media.TraktId)
+	}
+
+	if ids.ImdbId != "" {
+		result, err := c.search("imdb", ids.ImdbId, RequestTypeTvShow)
+		if err == nil && result != nil {
+			return result.Ids.Trakt
+		}
+	}
+
+	if ids.TvdbId != "" {
+		result, err := c.search("tvdb", ids.TvdbId.String(), RequestTypeTvShow)
+		if err == nil && result != nil {
+			return result.Ids.Trakt
+		}
+	}
+
+	return ""
+}
+
+// Search trakt for media by an external id, nil if there is no match
+func (c *Client) search(idType string, id string, mediaType string) (*searchMedia, error) {
+	httpResponse, err := c.queryApi(requestParameters{
+		method: http.MethodGet,
+		path:   fmt.Sprintf("/search/%s/%s?type=%s", idType, id, mediaType),
+	})
+	if err != nil {
+		log.Printf("search: unable to look up %s %s: %v", idType, id, err)
+		return nil, fmt.Errorf("search: %w", err)
+	}
+
+	defer c.close(httpResponse.Body)
+
+	var results []searchResult
+	err = json.NewDecoder(httpResponse.Body).Decode(&results)
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+
+	for _, result := range results {
+		if result.Type == RequestTypeMovie && result.Movie != nil && result.Movie.Ids.Trakt != "" {
+			c.cacheMedia(mediaType, result.Movie)
+			return result.Movie, nil
+		}
+
+		if result.Type == RequestTypeTvShow && result.Show != nil && result.Show.Ids.Trakt != "" {
+			c.cacheMedia(mediaType, result.Show)
+			return result.Show, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,265 @@
+package trakt
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	db "github.com/sjdaws/overtrakt/database"
+)
+
+// Maximum number of items sent to trakt in a single request
+const syncBatchSize = 100
+
+// SyncReport summarises the outcome of replaying unsynced requests
+type SyncReport struct {
+	Added        int
+	Errored      int
+	Errors       []error
+	Existing     int
+	NotFound     int
+	Skipped      int
+	Unauthorised []string
+}
+
+// Outcome of syncing a request to every one of its targets
+type syncOutcome struct {
+	failed   error
+	notFound error
+}
+
+func (r *Registry) SyncUnsynced(targetsFor func(request *db.TraktRequest) []Target, maxAttempts int) (*SyncReport, error) {
+	unsynced, err := r.database.GetUnsyncedReleases(maxAttempts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SyncReport{
+		Errors:       make([]error, 0),
+		Unauthorised: make([]string, 0),
+	}
+
+	// Group requests by target so each target is updated in as few calls as possible
+	targets := make([]Target, 0)
+	groups := make(map[Target][]*db.TraktRequest)
+	for _, request := range unsynced {
+		if request.RequestType != RequestTypeMovie && request.RequestType != RequestTypeTvShow {
+			continue
+		}
+
+		requestTargets := targetsFor(request)
+
+		// Requests for an account which needs authorising are left pending rather than using up attempts, other
+		// accounts carry on as normal
+		if account := r.unauthorisedAccount(requestTargets); account != "" {
+			report.skip(account)
+			continue
+		}
+
+		for _, target := range requestTargets {
+			if _, ok := groups[target]; !ok {
+				targets = append(targets, target)
+			}
+
+			groups[target] = append(groups[target], request)
+		}
+	}
+
+	// Requests are only recorded once every target has been tried
+	outcomes := make(map[*db.TraktRequest]*syncOutcome)
+	recorded := make([]*db.TraktRequest, 0)
+	outcomeFor := func(request *db.TraktRequest) *syncOutcome {
+		outcome, ok := outcomes[request]
+		if !ok {
+			outcome = &syncOutcome{}
+			outcomes[request] = outcome
+			recorded = append(recorded, request)
+		}
+
+		return outcome
+	}
+
+	for _, target := range targets {
+		requests := groups[target]
+
+		client, err := r.Client(target.Account())
+		if err != nil {
+			report.fail(requests, err)
+			for _, request := range requests {
+				outcome := outcomeFor(request)
+				outcome.failed = firstError(outcome.failed, err)
+			}
+			continue
+		}
+
+		for start := 0; start < len(requests); start += syncBatchSize {
+			end := start + syncBatchSize
+			if end > len(requests) {
+				end = len(requests)
+			}
+
+			results, response, err := client.addBatchToTarget(requests[start:end], target)
+			if err != nil {
+				report.fail(requests[start:end], err)
+				for _, request := range requests[start:end] {
+					outcome := outcomeFor(request)
+					outcome.failed = firstError(outcome.failed, err)
+				}
+				continue
+			}
+
+			report.Added += response.Added.Movies + response.Added.Shows + response.Added.Seasons
+			report.Existing += response.Existing.Movies + response.Existing.Shows + response.Existing.Seasons
+
+			for _, result := range results {
+				outcome := outcomeFor(result.Request)
+				if result.Error != nil {
+					report.NotFound++
+					report.Errors = append(report.Errors, result.Error)
+					outcome.notFound = firstError(outcome.notFound, result.Error)
+				}
+			}
+		}
+	}
+
+	for _, request := range recorded {
+		outcome := outcomes[request]
+		switch {
+		case outcome.failed != nil:
+			r.recordAttempt(request, db.RequestStatusFailed, outcome.failed)
+
+		case outcome.notFound != nil:
+			r.recordAttempt(request, db.RequestStatusNotFound, outcome.notFound)
+
+		default:
+			r.recordAttempt(request, db.RequestStatusSynced, nil)
+		}
+	}
+
+	return report, nil
+}
+
+// Failed is true if any request couldn't be synced
+func (r *SyncReport) Failed() bool {
+	return r.Errored > 0 || r.NotFound > 0 || r.Skipped > 0
+}
+
+func (r *SyncReport) String() string {
+	summary := r.Summary()
+	if len(r.Errors) == 0 {
+		return summary
+	}
+
+	errors := make([]string, 0, len(r.Errors))
+	for _, err := range r.Errors {
+		errors = append(errors, fmt.Sprintf("- %v", err))
+	}
+
+	return fmt.Sprintf("%s\n%s", summary, strings.Join(errors, "\n"))
+}
+
+// Summary is the counts without the errors
+func (r *SyncReport) Summary() string {
+	summary := fmt.Sprintf("%d added, %d already present, %d not found, %d errored", r.Added, r.Existing, r.NotFound, r.Errored)
+	if r.Skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped as %s not authorised", r.Skipped, strings.Join(r.Unauthorised, ", "))
+	}
+
+	return summary
+}
+
+func (r *SyncReport) Total() int {
+	return r.Added + r.Existing + r.NotFound + r.Errored
+}
+
+// Record an error which affected a number of requests
+func (r *SyncReport) fail(requests []*db.TraktRequest, err error) {
+	r.Errored += len(requests)
+	r.Errors = append(r.Errors, fmt.Errorf("%d request(s) failed: %w", len(requests), err))
+}
+
+// Record a request which was skipped because an account needs authorising
+func (r *SyncReport) skip(account string) {
+	r.Skipped++
+
+	for _, existing := range r.Unauthorised {
+		if existing == account {
+			return
+		}
+	}
+
+	r.Unauthorised = append(r.Unauthorised, account)
+}
+
+// The first account in the targets which needs authorising, empty if every account is ready
+func (r *Registry) unauthorisedAccount(targets []Target) string {
+	for _, target := range targets {
+		if r.NeedsAuthorisation(target.Account()) {
+			return target.Account()
+		}
+	}
+
+	return ""
+}
+
+// Add a batch of requests to a target in a single call and match the response back to each request
+func (c *Client) addBatchToTarget(requests []*db.TraktRequest, target Target) ([]syncResult, *addUserListResponse, error) {
+	body := addUserListRequest{
+		Movies: make([]movieIds, 0),
+		Shows:  make([]showIds, 0),
+	}
+
+	for _, request := range requests {
+		switch request.RequestType {
+		case RequestTypeMovie:
+			ids := movieIdFor(request.ImdbId, request.TmdbId)
+			ids.TraktId = traktIdFor(c.lookupMedia(RequestTypeMovie, request.ImdbId, request.TmdbId, ""))
+			body.Movies = append(body.Movies, movieIds{Ids: ids})
+
+		case RequestTypeTvShow:
+			item := c.showItemFor(request)
+			item.Ids.TraktId = traktIdFor(c.lookupMedia(RequestTypeTvShow, request.ImdbId, "", request.TvdbId))
+			body.Shows = append(body.Shows, item)
+		}
+	}
+
+	response, err := c.addToTarget(target, body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sync: %w", err)
+	}
+
+	results := make([]syncResult, 0, len(requests))
+	for _, request := range requests {
+		result := syncResult{
+			Request: request,
+		}
+
+		switch request.RequestType {
+		case RequestTypeMovie:
+			media := c.lookupMedia(RequestTypeMovie, request.ImdbId, request.TmdbId, "")
+			ids := movieIdFor(request.ImdbId, request.TmdbId)
+			for _, item := range response.NotFound.Movies {
+				if item.Ids.matches(ids) {
+					result.Error = fmt.Errorf("movie not found on trakt: %s", mediaLabel(media, ids))
+					break
+				}
+			}
+
+		case RequestTypeTvShow:
+			media := c.lookupMedia(RequestTypeTvShow, request.ImdbId, "", request.TvdbId)
+			ids := showIdFor(request.ImdbId, request.TvdbId)
+			for _, item := range response.NotFound.Shows {
+				if item.Ids.matches(ids) {
+					result.Error = fmt.Errorf("tv show not found on trakt: %s", mediaLabel(media, ids))
+					break
+				}
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	log.Printf("sync: added %d movie(s), %d tv show(s) and %d season(s) to %s, %d movie(s), %d tv show(s) and %d season(s) already existed, %d not found", response.Added.Movies, response.Added.Shows, response.Added.Seasons, target, response.Existing.Movies, response.Existing.Shows, response.Existing.Seasons, len(response.NotFound.Movies)+len(response.NotFound.Shows))
+
+	return results, response, nil
+}
@@ -0,0 +1,154 @@
+package trakt
+
+import (
+	"fmt"
+)
+
+const (
+	TargetCollection = "collection"
+	TargetList       = "list"
+	TargetWatchlist  = "watchlist"
+)
+
+// Target is somewhere on trakt requests are sent to, every target accepts the same items and responds in the
+// same format so only where items are sent differs
+type Target interface {
+	// Account is the trakt account which owns the target
+	Account() string
+	String() string
+	// Type is one of the target type constants
+	Type() string
+	// Validate checks the target has everything needed to send requests to it
+	Validate() error
+
+	addPath() string
+	removePath() string
+}
+
+// A custom list belonging to a user
+type listTarget struct {
+	account string
+	listId  string
+}
+
+// The authorised user's watchlist
+type watchlistTarget struct {
+	account string
+}
+
+// The authorised user's collection
+type collectionTarget struct {
+	account string
+}
+
+// NewTarget creates a target by type, the list is only used by list targets
+func NewTarget(targetType string, account string, listId string) (Target, error) {
+	switch targetType {
+	case TargetCollection:
+		return NewCollectionTarget(account), nil
+
+	case TargetList:
+		return NewListTarget(account, listId), nil
+
+	case TargetWatchlist:
+		return NewWatchlistTarget(account), nil
+	}
+
+	return nil, fmt.Errorf("target: unknown target type %q, expected %s, %s or %s", targetType, TargetCollection, TargetList, TargetWatchlist)
+}
+
+func NewCollectionTarget(account string) Target {
+	return collectionTarget{account: account}
+}
+
+func NewListTarget(account string, listId string) Target {
+	return listTarget{account: account, listId: listId}
+}
+
+func NewWatchlistTarget(account string) Target {
+	return watchlistTarget{account: account}
+}
+
+func (t listTarget) Account() string {
+	return t.account
+}
+
+func (t listTarget) String() string {
+	return fmt.Sprintf("%s list %s", t.account, t.listId)
+}
+
+func (t listTarget) Type() string {
+	return TargetList
+}
+
+func (t listTarget) Validate() error {
+	if t.listId == "" {
+		return fmt.Errorf("target: list target for %s has no list", t.account)
+	}
+
+	return validateAccount(TargetList, t.account)
+}
+
+func (t listTarget) addPath() string {
+	return fmt.Sprintf("/users/%s/lists/%s/items", t.account, t.listId)
+}
+
+func (t listTarget) removePath() string {
+	return t.addPath() + "/remove"
+}
+
+func (t watchlistTarget) Account() string {
+	return t.account
+}
+
+func (t watchlistTarget) String() string {
+	return fmt.Sprintf("%s watchlist", t.account)
+}
+
+func (t watchlistTarget) Type() string {
+	return TargetWatchlist
+}
+
+func (t watchlistTarget) Validate() error {
+	return validateAccount(TargetWatchlist, t.account)
+}
+
+func (t watchlistTarget) addPath() string {
+	return "/sync/watchlist"
+}
+
+func (t watchlistTarget) removePath() string {
+	return "/sync/watchlist/remove"
+}
+
+func (t collectionTarget) Account() string {
+	return t.account
+}
+
+func (t collectionTarget) String() string {
+	return fmt.Sprintf("%s collection", t.account)
+}
+
+func (t collectionTarget) Type() string {
+	return TargetCollection
+}
+
+func (t collectionTarget) Validate() error {
+	return validateAccount(TargetCollection, t.account)
+}
+
+func (t collectionTarget) addPath() string {
+	return "/sync/collection"
+}
+
+func (t collectionTarget) removePath() string {
+	return "/sync/collection/remove"
+}
+
+func validateAccount(targetType string, account string) error {
+	if account == "" {
+		return fmt.Errorf("target: %s target has no trakt user", targetType)
+	}
+
+	return nil
+}
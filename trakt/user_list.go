@@ -3,10 +3,13 @@ package trakt
 import (
 	"encoding/json"
 	"fmt"
-	db "github.com/sjdaws/overtrakt/database"
-	"github.com/sjdaws/overtrakt/notify"
 	"log"
+	"sort"
+	"strconv"
 	"strings"
+
+	db "github.com/sjdaws/overtrakt/database"
+	"github.com/sjdaws/overtrakt/notify"
 )
 
 const (
@@ -25,14 +28,21 @@ type addUserListResponse struct {
 	NotFound addUserListRequest `json:"not_found"`
 }
 
+type removeUserListResponse struct {
+	Deleted  addResult          `json:"deleted"`
+	NotFound addUserListRequest `json:"not_found"`
+}
+
 type addResult struct {
-	Movies int `json:"movies"`
-	Shows  int `json:"shows"`
+	Movies  int `json:"movies"`
+	Seasons int `json:"seasons"`
+	Shows   int `json:"shows"`
 }
 
 type movieId struct {
-	ImdbId string `json:"imdb"`
-	TmdbId string `json:"tmdb"`
+	ImdbId  string      `json:"imdb,omitempty"`
+	TmdbId  json.Number `json:"tmdb,omitempty"`
+	TraktId json.Number `json:"trakt,omitempty"`
 }
 
 type movieIds struct {
@@ -40,12 +50,18 @@ type movieIds struct {
 }
 
 type showId struct {
-	ImdbId string `json:"imdb"`
-	TvdbId string `json:"tvdb"`
+	ImdbId  string      `json:"imdb,omitempty"`
+	TraktId json.Number `json:"trakt,omitempty"`
+	TvdbId  json.Number `json:"tvdb,omitempty"`
 }
 
 type showIds struct {
-	Ids showId `json:"ids"`
+	Ids     showId        `json:"ids"`
+	Seasons []seasonItems `json:"seasons,omitempty"`
+}
+
+type seasonItems struct {
+	Number int `json:"number"`
 }
 
 type syncResult struct {
@@ -53,136 +69,362 @@ type syncResult struct {
 	Error   error
 }
 
-func (c *Client) AddMovieToUserList(imdbId string, tmdbId string, userId string, userListId string) error {
-	if imdbId == "" && tmdbId == "" {
-		return fmt.Errorf("user_list: unable to add movie to trakt, no ids are supplied")
+// UserLists are the trakt lists a request should be added to
+type UserLists struct {
+	Movie4kListId  string
+	MovieListId    string
+	TvShow4kListId string
+	TvShowListId   string
+	UserId         string
+}
+
+// MovieList is the list for a movie request, 4k requests use the 4k list if there is one
+func (l UserLists) MovieList(is4k bool) string {
+	if is4k && l.Movie4kListId != "" {
+		return l.Movie4kListId
+	}
+
+	return l.MovieListId
+}
+
+// TvShowList is the list for a tv show request, 4k requests use the 4k list if there is one
+func (l UserLists) TvShowList(is4k bool) string {
+	if is4k && l.TvShow4kListId != "" {
+		return l.TvShow4kListId
 	}
 
-	request := &db.TraktRequest{
-		ImdbId:      imdbId,
-		RequestType: RequestTypeMovie,
-		TmdbId:      tmdbId,
-		TvdbId:      "",
+	return l.TvShowListId
+}
+
+// Add records the request and sends it to every target, it's only synced once every target has it
+func (r *Registry) Add(request *db.TraktRequest, targets []Target) error {
+	err := prepareRequest(request, "add")
+	if err != nil {
+		return err
 	}
 
 	// Don't die on db error, we can continue anyway
-	err := c.database.AddTraktRequest(request)
+	watched, err := r.saveRequest(request)
 	if err != nil {
-		log.Printf("user_list: error adding movie request to database: %v", err)
+		log.Printf("user_list: error adding %s request to database: %v", kindOf(request), err)
+	}
+
+	// Watched requests have been pruned from the lists, adding them again would undo it
+	if watched {
+		log.Printf("user_list: %s request %s has already been watched, skipping", kindOf(request), request.RequestId)
+		return nil
+	}
+
+	if len(targets) == 0 {
+		return fmt.Errorf("user_list: no targets for %s request", kindOf(request))
 	}
 
-	var ids movieId
-	if tmdbId != "" {
-		ids = movieId{
-			TmdbId: tmdbId,
+	var failed error
+	var notFound error
+	for _, target := range targets {
+		err := target.Validate()
+		if err != nil {
+			failed = firstError(failed, err)
+			continue
 		}
-	} else {
-		ids = movieId{
-			ImdbId: imdbId,
+
+		client, err := r.Client(target.Account())
+		if err != nil {
+			failed = firstError(failed, err)
+			continue
+		}
+
+		label, success, err := client.addRequest(request, target)
+		if err != nil {
+			failed = firstError(failed, fmt.Errorf("user_list: %s: %w", target, err))
+			continue
+		}
+
+		message := reportAdd(kindOf(request), label, target, success)
+		if success == 0 {
+			notFound = firstError(notFound, fmt.Errorf("%s", message))
 		}
 	}
 
-	httpResponse, err := c.queryApi(requestParameters{
-		body: addUserListRequest{
-			Movies: []movieIds{
-				{
-					Ids: ids,
-				},
-			},
-		},
-		path: fmt.Sprintf("/users/%s/lists/%s/items", userId, userListId),
-	})
+	switch {
+	case failed != nil:
+		r.recordAttempt(request, db.RequestStatusFailed, failed)
+		return failed
+
+	case notFound != nil:
+		r.recordAttempt(request, db.RequestStatusNotFound, notFound)
+
+	default:
+		r.recordAttempt(request, db.RequestStatusSynced, nil)
+	}
+
+	return nil
+}
+
+// Queue records the request with its status without sending it, pending requests are added to trakt by the next
+// sync, returns false if the request was already stored as stored requests are left alone
+func (r *Registry) Queue(request *db.TraktRequest) (bool, error) {
+	err := prepareRequest(request, "queue")
 	if err != nil {
-		return fmt.Errorf("user_list: %v", err)
+		return false, err
 	}
 
-	defer c.close(httpResponse.Body)
+	inserted, err := r.database.InsertTraktRequest(request)
+	if err != nil {
+		return false, fmt.Errorf("user_list: %w", err)
+	}
 
-	var response addUserListResponse
-	err = json.NewDecoder(httpResponse.Body).Decode(&response)
+	return inserted, nil
+}
+
+// Remove takes the request off every target
+func (r *Registry) Remove(request *db.TraktRequest, targets []Target) error {
+	err := prepareRequest(request, "remove")
 	if err != nil {
-		return fmt.Errorf("user_list: %v", err)
+		return err
 	}
 
-	errors := make([]string, 0)
-	if len(response.NotFound.Movies) > 0 {
-		for _, id := range response.NotFound.Movies {
-			if id.Ids.TmdbId != "" {
-				errors = append(errors, fmt.Sprintf("tmdb: %s", id.Ids.TmdbId))
-			}
-			if id.Ids.ImdbId != "" {
-				errors = append(errors, fmt.Sprintf("imdb: %s", id.Ids.ImdbId))
+	existing, err := r.database.FindTraktRequest(request)
+	if err != nil {
+		log.Printf("user_list: error reading %s request from database: %v", kindOf(request), err)
+	}
+
+	// Without seasons in the notification remove whichever seasons were added
+	if existing != nil && request.RequestType == RequestTypeTvShow && len(request.Seasons) == 0 {
+		request.Seasons = existing.Seasons
+	}
+
+	// Removing some seasons leaves the rest of the request on the lists
+	var remaining []int
+	partial := false
+	if existing != nil {
+		remaining, partial = remainingSeasons(existing, request)
+	}
+
+	var failed error
+	for _, target := range targets {
+		err := target.Validate()
+		if err != nil {
+			failed = firstError(failed, err)
+			continue
+		}
+
+		client, err := r.Client(target.Account())
+		if err != nil {
+			failed = firstError(failed, err)
+			continue
+		}
+
+		// Lists hold the whole show when seasons aren't sent, it stays while other seasons are still requested
+		if partial && !client.seasonRequests {
+			continue
+		}
+
+		label, deleted, err := client.removeRequest(request, target)
+		if err != nil {
+			failed = firstError(failed, fmt.Errorf("user_list: %s: %w", target, err))
+			continue
+		}
+
+		reportRemove(kindOf(request), label, target, deleted)
+	}
+
+	if failed != nil {
+		return failed
+	}
+
+	// Only requests which were stored are recorded, otherwise a later request would pick up this one's seasons
+	if existing == nil {
+		return nil
+	}
+
+	if partial {
+		if len(remaining) > 0 {
+			err = r.database.SetTraktRequestSeasons(request, remaining)
+			if err != nil {
+				log.Printf("user_list: error updating %s request in database: %v", request.RequestType, err)
 			}
 		}
+
+		return nil
 	}
 
-	success := response.Added.Movies + response.Existing.Movies
-	total := success + len(errors)
+	// Items which aren't on the list have been removed as far as we're concerned
+	r.recordAttempt(request, db.RequestStatusRemoved, nil)
 
-	message := ""
+	return nil
+}
 
-	if len(errors) > 0 {
-		message = fmt.Sprintf("Error adding %d/%d movie(s) to trakt: %s\n", len(errors), total, strings.Join(errors, ","))
+// Store a request as pending unless it's already synced, returns true if the same request has already been watched
+func (r *Registry) saveRequest(request *db.TraktRequest) (bool, error) {
+	existing, err := r.database.FindTraktRequest(request)
+	if err != nil {
+		log.Printf("user_list: error reading %s request from database: %v", kindOf(request), err)
 	}
-	if success > 0 {
-		message = fmt.Sprintf("Successfully added %d/%d movie(s) to trakt\n", success, total)
+
+	// Seasons accumulate across requests so a later request for more seasons updates the list entry, seasons which
+	// were removed aren't brought back
+	if existing != nil && existing.Status != db.RequestStatusRemoved && request.RequestType == RequestTypeTvShow {
+		request.Seasons = db.CombineSeasons(existing.Seasons, request.Seasons)
 	}
 
-	log.Printf("user_list: %s", message)
-	notify.Message(message)
+	watched := existing != nil && existing.Status == db.RequestStatusWatched && existing.RequestId == request.RequestId
 
-	if success > 0 {
-		request.Added = true
-		err = c.database.UpdateTraktRequest(request)
+	return watched, r.database.AddTraktRequest(request)
+}
+
+// Send a single request to a target, returns a label for the media and how many items trakt now has
+func (c *Client) addRequest(request *db.TraktRequest, target Target) (string, int, error) {
+	if request.RequestType == RequestTypeMovie {
+		ids := movieIdFor(request.ImdbId, request.TmdbId)
+		ids.TraktId = traktIdFor(c.lookupMedia(RequestTypeMovie, request.ImdbId, request.TmdbId, ""))
+
+		response, err := c.addToTarget(target, addUserListRequest{
+			Movies: []movieIds{
+				{
+					Ids: ids,
+				},
+			},
+		})
 		if err != nil {
-			log.Printf("user_list: error updating movie request in database: %v", err)
+			return "", 0, err
 		}
+
+		// Anything trakt couldn't match by external id has been searched for and cached by now
+		media := c.lookupMedia(RequestTypeMovie, request.ImdbId, request.TmdbId, "")
+
+		return mediaLabel(media, ids), response.Added.Movies + response.Existing.Movies, nil
 	}
 
-	return nil
+	item := c.showItemFor(request)
+	item.Ids.TraktId = traktIdFor(c.lookupMedia(RequestTypeTvShow, request.ImdbId, "", request.TvdbId))
+
+	response, err := c.addToTarget(target, addUserListRequest{
+		Shows: []showIds{item},
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	media := c.lookupMedia(RequestTypeTvShow, request.ImdbId, "", request.TvdbId)
+
+	return mediaLabel(media, item.Ids) + describeSeasons(item.Seasons), response.Added.Shows + response.Added.Seasons + response.Existing.Shows + response.Existing.Seasons, nil
 }
 
-func (c *Client) AddShowToUserList(imdbId string, tvdbId string, userId string, userListId string) error {
-	if imdbId == "" && tvdbId == "" {
-		return fmt.Errorf("user_list: unable to add tv show to trakt, no ids are supplied")
+// Remove a single request from a target, returns a label for the media and how many items were deleted
+func (c *Client) removeRequest(request *db.TraktRequest, target Target) (string, int, error) {
+	if request.RequestType == RequestTypeMovie {
+		media := c.lookupMedia(RequestTypeMovie, request.ImdbId, request.TmdbId, "")
+		ids := movieIdFor(request.ImdbId, request.TmdbId)
+		ids.TraktId = traktIdFor(media)
+
+		response, err := c.removeFromTarget(target, addUserListRequest{
+			Movies: []movieIds{
+				{
+					Ids: ids,
+				},
+			},
+		})
+		if err != nil {
+			return "", 0, err
+		}
+
+		return mediaLabel(media, ids), response.Deleted.Movies, nil
 	}
 
-	request := &db.TraktRequest{
-		ImdbId:      imdbId,
-		RequestType: RequestTypeTvShow,
-		TmdbId:      "",
-		TvdbId:      tvdbId,
+	media := c.lookupMedia(RequestTypeTvShow, request.ImdbId, "", request.TvdbId)
+	item := c.showItemFor(request)
+	item.Ids.TraktId = traktIdFor(media)
+
+	response, err := c.removeFromTarget(target, addUserListRequest{
+		Shows: []showIds{item},
+	})
+	if err != nil {
+		return "", 0, err
 	}
 
-	// Don't die on db error, we can continue anyway
-	err := c.database.AddTraktRequest(request)
+	return mediaLabel(media, item.Ids) + describeSeasons(item.Seasons), response.Deleted.Shows + response.Deleted.Seasons, nil
+}
+
+// Add items to a target, anything trakt can't match by external id is looked up and retried by trakt id
+func (c *Client) addToTarget(target Target, body addUserListRequest) (*addUserListResponse, error) {
+	response, err := c.postItems(target.addPath(), body)
 	if err != nil {
-		log.Printf("user_list: error adding tv show request to database: %v", err)
+		return nil, err
+	}
+
+	if len(response.NotFound.Movies) == 0 && len(response.NotFound.Shows) == 0 {
+		return response, nil
 	}
 
-	var ids showId
-	if tvdbId != "" {
-		ids = showId{
-			TvdbId: tvdbId,
+	retry := addUserListRequest{
+		Movies: make([]movieIds, 0),
+		Shows:  make([]showIds, 0),
+	}
+	notFound := addUserListRequest{
+		Movies: make([]movieIds, 0),
+		Shows:  make([]showIds, 0),
+	}
+	resolvedMovies := make(map[json.Number]movieIds)
+	resolvedShows := make(map[json.Number]showIds)
+
+	for _, item := range response.NotFound.Movies {
+		traktId := c.resolveMovie(item.Ids)
+		if traktId == "" {
+			notFound.Movies = append(notFound.Movies, item)
+			continue
 		}
-	} else {
-		ids = showId{
-			ImdbId: imdbId,
+
+		resolvedMovies[traktId] = item
+		retry.Movies = append(retry.Movies, movieIds{Ids: movieId{TraktId: traktId}})
+	}
+
+	for _, item := range response.NotFound.Shows {
+		traktId := c.resolveShow(item.Ids)
+		if traktId == "" {
+			notFound.Shows = append(notFound.Shows, item)
+			continue
 		}
+
+		resolvedShows[traktId] = item
+		retry.Shows = append(retry.Shows, showIds{Ids: showId{TraktId: traktId}, Seasons: item.Seasons})
 	}
 
+	if len(retry.Movies) > 0 || len(retry.Shows) > 0 {
+		retried, err := c.postItems(target.addPath(), retry)
+		if err != nil {
+			return nil, err
+		}
+
+		response.Added.Movies += retried.Added.Movies
+		response.Added.Seasons += retried.Added.Seasons
+		response.Added.Shows += retried.Added.Shows
+		response.Existing.Movies += retried.Existing.Movies
+		response.Existing.Seasons += retried.Existing.Seasons
+		response.Existing.Shows += retried.Existing.Shows
+
+		// Report failures against the ids which were originally requested
+		for _, item := range retried.NotFound.Movies {
+			notFound.Movies = append(notFound.Movies, resolvedMovies[item.Ids.TraktId])
+		}
+
+		for _, item := range retried.NotFound.Shows {
+			notFound.Shows = append(notFound.Shows, resolvedShows[item.Ids.TraktId])
+		}
+	}
+
+	response.NotFound = notFound
+
+	return response, nil
+}
+
+func (c *Client) postItems(path string, body addUserListRequest) (*addUserListResponse, error) {
 	httpResponse, err := c.queryApi(requestParameters{
-		body: addUserListRequest{
-			Shows: []showIds{
-				{
-					Ids: ids,
-				},
-			},
-		},
-		path: fmt.Sprintf("/users/%s/lists/%s/items", userId, userListId),
+		body: body,
+		path: path,
 	})
 	if err != nil {
-		return fmt.Errorf("user_list: %v", err)
+		return nil, err
 	}
 
 	defer c.close(httpResponse.Body)
@@ -190,68 +432,235 @@ func (c *Client) AddShowToUserList(imdbId string, tvdbId string, userId string,
 	var response addUserListResponse
 	err = json.NewDecoder(httpResponse.Body).Decode(&response)
 	if err != nil {
-		return fmt.Errorf("user_list: %v", err)
+		return nil, err
 	}
 
-	errors := make([]string, 0)
-	if len(response.NotFound.Shows) > 0 {
-		for _, id := range response.NotFound.Shows {
-			if id.Ids.TvdbId != "" {
-				errors = append(errors, fmt.Sprintf("tvdb: %s", id.Ids.TvdbId))
-			}
-			if id.Ids.ImdbId != "" {
-				errors = append(errors, fmt.Sprintf("imdb: %s", id.Ids.ImdbId))
-			}
-		}
+	return &response, nil
+}
+
+// Record the outcome of updating trakt against the request, database errors aren't fatal
+func (r *Registry) recordAttempt(request *db.TraktRequest, status string, err error) {
+	request.LastError = ""
+	if err != nil {
+		request.LastError = err.Error()
 	}
+	request.Status = status
 
-	success := response.Added.Shows + response.Existing.Shows
-	total := success + len(errors)
+	err = r.database.UpdateTraktRequest(request)
+	if err != nil {
+		log.Printf("user_list: error updating %s request in database: %v", request.RequestType, err)
+	}
+}
+
+func (c *Client) removeFromTarget(target Target, body addUserListRequest) (*removeUserListResponse, error) {
+	httpResponse, err := c.queryApi(requestParameters{
+		body: body,
+		path: target.removePath(),
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	message := ""
+	defer c.close(httpResponse.Body)
 
-	if len(errors) > 0 {
-		message = fmt.Sprintf("Error adding %d/%d tv show(s) to trakt: %s\n", len(errors), total, strings.Join(errors, ","))
+	var response removeUserListResponse
+	err = json.NewDecoder(httpResponse.Body).Decode(&response)
+	if err != nil {
+		return nil, err
 	}
+
+	return &response, nil
+}
+
+// Log and notify the result of adding a single request, the message is returned so failures can be recorded
+func reportAdd(kind string, label string, target Target, success int) string {
+	var message string
 	if success > 0 {
-		message = fmt.Sprintf("Successfully added %d/%d tv show(s) to trakt\n", success, total)
+		message = fmt.Sprintf("Successfully added %s %s to trakt %s", kind, label, target)
+	} else {
+		message = fmt.Sprintf("Error adding %s %s to trakt %s: not found", kind, label, target)
 	}
 
 	log.Printf("user_list: %s", message)
 	notify.Message(message)
 
-	if success > 0 {
-		request.Added = true
-		err = c.database.UpdateTraktRequest(request)
-		if err != nil {
-			log.Printf("user_list: error updating tv show request in database: %v", err)
+	return message
+}
+
+// Log and notify the result of removing a single request
+func reportRemove(kind string, label string, target Target, deleted int) {
+	var message string
+	if deleted > 0 {
+		message = fmt.Sprintf("Successfully removed %s %s from trakt %s", kind, label, target)
+	} else {
+		message = fmt.Sprintf("Unable to find %s %s to remove from trakt %s", kind, label, target)
+	}
+
+	log.Printf("user_list: %s", message)
+	notify.Message(message)
+}
+
+func (i movieId) String() string {
+	return describeIds(map[string]string{"imdb": i.ImdbId, "tmdb": i.TmdbId.String(), "trakt": i.TraktId.String()})
+}
+
+// Matches if any id is the same
+func (i movieId) matches(other movieId) bool {
+	return (i.ImdbId != "" && i.ImdbId == other.ImdbId) ||
+		(i.TmdbId != "" && i.TmdbId == other.TmdbId) ||
+		(i.TraktId != "" && i.TraktId == other.TraktId)
+}
+
+func (i showId) String() string {
+	return describeIds(map[string]string{"imdb": i.ImdbId, "trakt": i.TraktId.String(), "tvdb": i.TvdbId.String()})
+}
+
+// Matches if any id is the same
+func (i showId) matches(other showId) bool {
+	return (i.ImdbId != "" && i.ImdbId == other.ImdbId) ||
+		(i.TraktId != "" && i.TraktId == other.TraktId) ||
+		(i.TvdbId != "" && i.TvdbId == other.TvdbId)
+}
+
+// Keep the first error which occurred
+func firstError(current error, err error) error {
+	if current != nil {
+		return current
+	}
+
+	return err
+}
+
+// Human readable name for the type of request
+func kindOf(request *db.TraktRequest) string {
+	if request.RequestType == RequestTypeTvShow {
+		return "tv show"
+	}
+
+	return request.RequestType
+}
+
+// Check a request has ids for its type and clear any which don't apply
+func prepareRequest(request *db.TraktRequest, action string) error {
+	switch request.RequestType {
+	case RequestTypeMovie:
+		request.TvdbId = ""
+		if request.ImdbId == "" && request.TmdbId == "" {
+			return fmt.Errorf("user_list: unable to %s movie, no ids are supplied", action)
 		}
+
+	case RequestTypeTvShow:
+		request.TmdbId = ""
+		if request.ImdbId == "" && request.TvdbId == "" {
+			return fmt.Errorf("user_list: unable to %s tv show, no ids are supplied", action)
+		}
+
+	default:
+		return fmt.Errorf("user_list: unable to %s %q request, unknown request type", action, request.RequestType)
 	}
 
 	return nil
 }
 
-func (c *Client) SyncUnsynced(movieListId string, tvShowListId string, userId string) (int, error) {
-	unsynced, err := c.database.GetUnsyncedReleases()
-	if err != nil {
-		return 0, err
+// Describe the seasons sent to trakt, empty when the whole show is sent
+func describeSeasons(seasons []seasonItems) string {
+	if len(seasons) == 0 {
+		return ""
 	}
 
-	var records int
-	for _, request := range unsynced {
-		switch request.RequestType {
-		case RequestTypeMovie:
-			_ = c.AddMovieToUserList(request.ImdbId, request.TmdbId, userId, movieListId)
+	numbers := make([]string, 0, len(seasons))
+	for _, season := range seasons {
+		numbers = append(numbers, strconv.Itoa(season.Number))
+	}
 
-		case RequestTypeTvShow:
-			_ = c.AddShowToUserList(request.ImdbId, request.TvdbId, userId, tvShowListId)
+	return fmt.Sprintf(" (seasons %s)", strings.Join(numbers, ", "))
+}
 
-		default:
+// Describe every known id in a stable order
+func describeIds(ids map[string]string) string {
+	descriptions := make([]string, 0)
+	for _, name := range []string{"imdb", "tmdb", "tvdb", "trakt"} {
+		if ids[name] != "" {
+			descriptions = append(descriptions, fmt.Sprintf("%s: %s", name, ids[name]))
+		}
+	}
+
+	return strings.Join(descriptions, " ")
+}
+
+// Send every known id for a movie so trakt can match on whichever it knows
+func movieIdFor(imdbId string, tmdbId string) movieId {
+	return movieId{
+		ImdbId: imdbId,
+		TmdbId: json.Number(tmdbId),
+	}
+}
+
+// Send every known id for a tv show so trakt can match on whichever it knows
+func showIdFor(imdbId string, tvdbId string) showId {
+	return showId{
+		ImdbId: imdbId,
+		TvdbId: json.Number(tvdbId),
+	}
+}
+
+// Seasons sorted and without duplicates
+func sortSeasons(seasons []int) []int {
+	seen := make(map[int]bool)
+	sorted := make([]int, 0, len(seasons))
+	for _, season := range seasons {
+		if seen[season] {
 			continue
 		}
 
-		records++
+		seen[season] = true
+		sorted = append(sorted, season)
+	}
+
+	sort.Ints(sorted)
+
+	return sorted
+}
+
+// Seasons left on a stored request once a removal's seasons are taken off, false once nothing is left. A whole show
+// can't have seasons taken off so it stays whole
+func remainingSeasons(existing *db.TraktRequest, request *db.TraktRequest) ([]int, bool) {
+	if request.RequestType != RequestTypeTvShow || len(request.Seasons) == 0 {
+		return nil, false
+	}
+
+	if len(existing.Seasons) == 0 {
+		return existing.Seasons, true
+	}
+
+	removed := make(map[int]bool)
+	for _, season := range request.Seasons {
+		removed[season] = true
+	}
+
+	remaining := make([]int, 0, len(existing.Seasons))
+	for _, season := range existing.Seasons {
+		if !removed[season] {
+			remaining = append(remaining, season)
+		}
+	}
+
+	return remaining, len(remaining) > 0
+}
+
+// Build the list item for a tv show, specific seasons are only sent when season requests are enabled
+func (c *Client) showItemFor(request *db.TraktRequest) showIds {
+	item := showIds{
+		Ids: showIdFor(request.ImdbId, request.TvdbId),
+	}
+
+	if !c.seasonRequests {
+		return item
+	}
+
+	for _, season := range sortSeasons(request.Seasons) {
+		item.Seasons = append(item.Seasons, seasonItems{Number: season})
 	}
 
-	return records, nil
+	return item
 }
@@ -0,0 +1,277 @@
+package trakt
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	db "github.com/sjdaws/overtrakt/database"
+)
+
+// PruneReport lists requests which have been watched and removed, or would be removed in a dry run
+type PruneReport struct {
+	DryRun       bool
+	Errors       []error
+	Pruned       []string
+	Unauthorised []string
+}
+
+type showProgress struct {
+	Aired         int       `json:"aired"`
+	Completed     int       `json:"completed"`
+	LastWatchedAt time.Time `json:"last_watched_at"`
+	Seasons       []struct {
+		Aired     int `json:"aired"`
+		Completed int `json:"completed"`
+		Number    int `json:"number"`
+	} `json:"seasons"`
+}
+
+type watchedItem struct {
+	LastWatchedAt time.Time    `json:"last_watched_at"`
+	Movie         *searchMedia `json:"movie"`
+	Show          *searchMedia `json:"show"`
+}
+
+// Watch history for an account, only fetched once per prune
+type watchHistory struct {
+	movies []watchedItem
+	shows  []watchedItem
+}
+
+// PruneWatched removes synced requests from their targets once the target's account has fully watched them and the
+// grace period has passed, in a dry run nothing is changed
+func (r *Registry) PruneWatched(targetsFor func(request *db.TraktRequest) []Target, grace time.Duration, dryRun bool) (*PruneReport, error) {
+	requests, err := r.database.GetSyncedRequests()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PruneReport{
+		DryRun:       dryRun,
+		Errors:       make([]error, 0),
+		Pruned:       make([]string, 0),
+		Unauthorised: make([]string, 0),
+	}
+
+	histories := make(map[string]*watchHistory)
+
+	for _, request := range requests {
+		targets := targetsFor(request)
+
+		eligible := 0
+		pruned := 0
+		failed := false
+		for _, target := range targets {
+			// Watching something doesn't mean it should leave the collection
+			if target.Type() == TargetCollection {
+				continue
+			}
+
+			eligible++
+
+			// Accounts which need authorising are checked next time, the rest carry on
+			if r.NeedsAuthorisation(target.Account()) {
+				report.skip(target.Account())
+				failed = true
+				continue
+			}
+
+			client, err := r.Client(target.Account())
+			if err != nil {
+				report.Errors = append(report.Errors, err)
+				failed = true
+				continue
+			}
+
+			history, ok := histories[target.Account()]
+			if !ok {
+				history, err = client.watchHistory()
+				if err != nil {
+					report.Errors = append(report.Errors, fmt.Errorf("watched: %s: %w", target.Account(), err))
+					failed = true
+					continue
+				}
+				histories[target.Account()] = history
+			}
+
+			watchedAt, err := client.fullyWatchedAt(request, history)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Errorf("watched: %w", err))
+				failed = true
+				continue
+			}
+
+			if watchedAt.IsZero() || time.Since(watchedAt) < grace {
+				continue
+			}
+
+			if dryRun {
+				label := client.requestLabel(request)
+				report.Pruned = append(report.Pruned, fmt.Sprintf("%s %s from %s, watched %s", kindOf(request), label, target, watchedAt.Format(time.RFC822)))
+				continue
+			}
+
+			label, _, err := client.removeRequest(request, target)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Errorf("watched: %s: %w", target, err))
+				failed = true
+				continue
+			}
+
+			report.Pruned = append(report.Pruned, fmt.Sprintf("%s %s from %s, watched %s", kindOf(request), label, target, watchedAt.Format(time.RFC822)))
+			pruned++
+		}
+
+		// Requests are only marked once they are off every list, those watched on some accounts but not others are
+		// checked again next time and removing from a list it's already gone from is harmless
+		if pruned > 0 && pruned == eligible && !failed {
+			r.recordAttempt(request, db.RequestStatusWatched, nil)
+		}
+	}
+
+	return report, nil
+}
+
+func (r *PruneReport) String() string {
+	action := "removed"
+	if r.DryRun {
+		action = "would be removed"
+	}
+
+	summary := fmt.Sprintf("%d watched item(s) %s, %d error(s)", len(r.Pruned), action, len(r.Errors))
+	if len(r.Unauthorised) > 0 {
+		summary += fmt.Sprintf(", %s skipped as not authorised", strings.Join(r.Unauthorised, ", "))
+	}
+
+	return summary
+}
+
+// Record an account which was skipped because it needs authorising
+func (r *PruneReport) skip(account string) {
+	for _, existing := range r.Unauthorised {
+		if existing == account {
+			return
+		}
+	}
+
+	r.Unauthorised = append(r.Unauthorised, account)
+}
+
+// When a request was fully watched, zero if it hasn't been, tv shows are only fully watched once every aired episode
+// of the requested seasons has been watched
+func (c *Client) fullyWatchedAt(request *db.TraktRequest, history *watchHistory) (time.Time, error) {
+	switch request.RequestType {
+	case RequestTypeMovie:
+		ids := movieIdFor(request.ImdbId, request.TmdbId)
+		ids.TraktId = traktIdFor(c.lookupMedia(RequestTypeMovie, request.ImdbId, request.TmdbId, ""))
+		for _, item := range history.movies {
+			if item.Movie != nil && ids.matches(movieId{ImdbId: item.Movie.Ids.Imdb, TmdbId: item.Movie.Ids.Tmdb, TraktId: item.Movie.Ids.Trakt}) {
+				return item.LastWatchedAt, nil
+			}
+		}
+
+	case RequestTypeTvShow:
+		ids := showIdFor(request.ImdbId, request.TvdbId)
+		ids.TraktId = traktIdFor(c.lookupMedia(RequestTypeTvShow, request.ImdbId, "", request.TvdbId))
+		for _, item := range history.shows {
+			if item.Show == nil || !ids.matches(showId{ImdbId: item.Show.Ids.Imdb, TraktId: item.Show.Ids.Trakt, TvdbId: item.Show.Ids.Tvdb}) {
+				continue
+			}
+
+			progress, err := c.showProgress(item.Show.Ids.Trakt)
+			if err != nil {
+				return time.Time{}, err
+			}
+
+			if !progress.complete(request.Seasons) {
+				return time.Time{}, nil
+			}
+
+			return progress.LastWatchedAt, nil
+		}
+	}
+
+	return time.Time{}, nil
+}
+
+// Label for a request using cached details
+func (c *Client) requestLabel(request *db.TraktRequest) string {
+	if request.RequestType == RequestTypeMovie {
+		ids := movieIdFor(request.ImdbId, request.TmdbId)
+		return mediaLabel(c.lookupMedia(RequestTypeMovie, request.ImdbId, request.TmdbId, ""), ids)
+	}
+
+	ids := showIdFor(request.ImdbId, request.TvdbId)
+
+	return mediaLabel(c.lookupMedia(RequestTypeTvShow, request.ImdbId, "", request.TvdbId), ids)
+}
+
+func (c *Client) showProgress(traktId json.Number) (*showProgress, error) {
+	var progress showProgress
+	err := c.getJson(fmt.Sprintf("/shows/%s/progress/watched?hidden=false&specials=false", traktId), &progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return &progress, nil
+}
+
+func (c *Client) watchHistory() (*watchHistory, error) {
+	history := &watchHistory{}
+
+	err := c.getJson("/sync/watched/movies", &history.movies)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.getJson("/sync/watched/shows?extended=noseasons", &history.shows)
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+func (c *Client) getJson(path string, result interface{}) error {
+	httpResponse, err := c.queryApi(requestParameters{
+		method: http.MethodGet,
+		path:   path,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer c.close(httpResponse.Body)
+
+	return json.NewDecoder(httpResponse.Body).Decode(result)
+}
+
+// Every aired episode has been watched, only the requested seasons are checked if there are any
+func (p *showProgress) complete(seasons []int) bool {
+	if len(seasons) == 0 {
+		return p.Aired > 0 && p.Completed >= p.Aired
+	}
+
+	for _, number := range seasons {
+		found := false
+		for _, season := range p.Seasons {
+			if season.Number != number {
+				continue
+			}
+
+			found = true
+			if season.Aired == 0 || season.Completed < season.Aired {
+				return false
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
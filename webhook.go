@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	db "github.com/sjdaws/overtrakt/database"
+	"github.com/sjdaws/overtrakt/ids"
+	"github.com/sjdaws/overtrakt/notify"
+	"github.com/sjdaws/overtrakt/trakt"
+)
+
+const (
+	mediaTypeMovie  = "movie"
+	mediaTypeTvShow = "tv"
+)
+
+type media struct {
+	ImdbId    string `json:"imdbId"`
+	MediaType string `json:"media_type"`
+	TmdbId    string `json:"tmdbId"`
+	TvdbId    string `json:"tvdbId"`
+}
+
+// Name of the extra field overseerr uses for the seasons of a tv request
+const extraRequestedSeasons = "Requested Seasons"
+
+type overseerrRequest struct {
+	Is4k             flexibleBool `json:"is4k"`
+	RequestId        string       `json:"request_id"`
+	RequestedByEmail string       `json:"requestedBy_email"`
+	RequestedByUser  string       `json:"requestedBy_username"`
+}
+
+type webhookExtra struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type webhookBody struct {
+	Event            string            `json:"event"`
+	Extra            []webhookExtra    `json:"extra"`
+	Image            string            `json:"image"`
+	Media            media             `json:"media"`
+	Message          string            `json:"message"`
+	NotificationType string            `json:"notification_type"`
+	Request          *overseerrRequest `json:"request"`
+	Subject          string            `json:"subject"`
+	Username         string            `json:"username"`
+}
+
+// Template variables are always strings in overseerr so accept "true" as well as true
+type flexibleBool bool
+
+func webhook(response http.ResponseWriter, request *http.Request) {
+	defer closeRequestBody(request.Body)
+
+	payload, err := io.ReadAll(request.Body)
+	if err != nil {
+		log.Printf("webhook: %v", err)
+		response.WriteHeader(400)
+		return
+	}
+
+	var webhookRequest webhookBody
+	err = json.Unmarshal(payload, &webhookRequest)
+	if err != nil {
+		log.Printf("webhook: %v", err)
+		notify.Message(fmt.Sprintf("Error reading webhook body: %v", err))
+		response.WriteHeader(400)
+		return
+	}
+
+	acceptWebhook(response, "overseerr", webhookRequest, payload)
+}
+
+// Acknowledge, ignore or queue a webhook depending on the action for its notification type
+func acceptWebhook(response http.ResponseWriter, source string, body webhookBody, payload []byte) {
+	switch notificationAction(body.NotificationType) {
+	case actionAcknowledge:
+		log.Printf("webhook: acknowledged %s notification", body.NotificationType)
+		notify.Message(fmt.Sprintf("Received %s notification from %s", body.NotificationType, source))
+		response.WriteHeader(200)
+		return
+
+	case actionIgnore:
+		log.Printf("webhook: ignoring %s notification", body.NotificationType)
+		response.WriteHeader(200)
+		return
+	}
+
+	// Reject anything which could never be sent to trakt rather than queueing it
+	_, err := normaliseMedia(body.Media)
+	if err != nil {
+		log.Printf("webhook: rejecting %s notification: %v", body.NotificationType, err)
+		response.WriteHeader(400)
+		_, _ = response.Write([]byte(err.Error()))
+		return
+	}
+
+	// Trakt is updated in the background so the sender isn't left waiting
+	err = queue.enqueue(payload)
+	if err != nil {
+		log.Printf("webhook: unable to queue %s notification: %v", body.NotificationType, err)
+		response.WriteHeader(500)
+		return
+	}
+
+	response.WriteHeader(202)
+}
+
+func addMedia(body webhookBody) error {
+	media, err := normaliseMedia(body.Media)
+	if err != nil {
+		return err
+	}
+
+	requests, err := requestsForMedia(traktRequestFor(body, media), actionAdd)
+	if err != nil {
+		return err
+	}
+
+	var failed error
+	for _, request := range requests {
+		targets, _ := routeRequest(request)
+
+		err = clients.Add(request, targets)
+		if err != nil && failed == nil {
+			failed = err
+		}
+	}
+
+	return failed
+}
+
+func removeMedia(body webhookBody) error {
+	media, err := normaliseMedia(body.Media)
+	if err != nil {
+		return err
+	}
+
+	requests, err := requestsForMedia(traktRequestFor(body, media), actionRemove)
+	if err != nil {
+		return err
+	}
+
+	var failed error
+	for _, request := range requests {
+		targets, _, err := routeRemoval(request)
+		if err == nil {
+			err = clients.Remove(request, targets)
+		}
+
+		if err != nil && failed == nil {
+			failed = err
+		}
+	}
+
+	return failed
+}
+
+// Radarr and sonarr don't know who requested something, their events apply to each stored request for the media so
+// they update the overseerr requests rather than storing another and deletes reach every requester's lists. Requests
+// with a requester, or for media which hasn't been stored, are returned as is
+func requestsForMedia(request *db.TraktRequest, action action) ([]*db.TraktRequest, error) {
+	if request.Requester != "" {
+		return []*db.TraktRequest{request}, nil
+	}
+
+	stored, err := database.FindTraktRequestsForMedia(request.RequestType, request.ImdbId, request.TmdbId, request.TvdbId)
+	if err != nil {
+		return nil, err
+	}
+
+	return matchStoredRequests(request, stored, action), nil
+}
+
+// Copy a request without a requester onto each stored request for the same media and quality. Adds skip requests which
+// were removed, radarr and sonarr send an add for every download so a declined request would otherwise come back, and
+// media which has only been removed isn't added at all
+func matchStoredRequests(request *db.TraktRequest, stored []*db.TraktRequest, action action) []*db.TraktRequest {
+	requests := make([]*db.TraktRequest, 0, len(stored))
+	skipped := 0
+	for _, existing := range stored {
+		if existing.Is4k != request.Is4k {
+			continue
+		}
+
+		if action == actionAdd && existing.Status == db.RequestStatusRemoved {
+			skipped++
+			continue
+		}
+
+		// The stored ids are used as they are part of the key, radarr and sonarr may know more ids than overseerr did
+		matched := *request
+		matched.ImdbId = existing.ImdbId
+		matched.TmdbId = existing.TmdbId
+		matched.TvdbId = existing.TvdbId
+		matched.Requester = existing.Requester
+		matched.RequestId = existing.RequestId
+		matched.RequesterMail = existing.RequesterMail
+		requests = append(requests, &matched)
+	}
+
+	if len(requests) == 0 && skipped == 0 {
+		return []*db.TraktRequest{request}
+	}
+
+	return requests
+}
+
+// Map an overseerr media type to a trakt request type, returns empty if the type isn't supported
+func requestTypeFor(mediaType string) string {
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case mediaTypeMovie:
+		return trakt.RequestTypeMovie
+
+	case mediaTypeTvShow, trakt.RequestTypeTvShow:
+		return trakt.RequestTypeTvShow
+	}
+
+	return ""
+}
+
+// Validate and normalise the ids overseerr has sent, zero ids are treated as missing
+func normaliseMedia(media media) (media, error) {
+	media.MediaType = strings.ToLower(strings.TrimSpace(media.MediaType))
+	if media.MediaType != mediaTypeMovie && media.MediaType != mediaTypeTvShow {
+		return media, fmt.Errorf("unsupported media type %q, expected %s or %s", media.MediaType, mediaTypeMovie, mediaTypeTvShow)
+	}
+
+	problems := make([]string, 0)
+
+	var err error
+	media.ImdbId, err = ids.Imdb(media.ImdbId)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	media.TmdbId, err = ids.Tmdb(media.TmdbId)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	media.TvdbId, err = ids.Tvdb(media.TvdbId)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if len(problems) > 0 {
+		return media, fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+
+	if media.MediaType == mediaTypeMovie {
+		media.TvdbId = ""
+		if media.ImdbId == "" && media.TmdbId == "" {
+			return media, fmt.Errorf("movie has no imdb or tmdb id")
+		}
+	} else {
+		media.TmdbId = ""
+		if media.ImdbId == "" && media.TvdbId == "" {
+			return media, fmt.Errorf("tv show has no imdb or tvdb id")
+		}
+	}
+
+	return media, nil
+}
+
+// Build the request stored against trakt, the requester is whoever made the request in overseerr if it's known
+func traktRequestFor(body webhookBody, media media) *db.TraktRequest {
+	request := &db.TraktRequest{
+		ImdbId:           media.ImdbId,
+		RequestType:      requestTypeFor(media.MediaType),
+		NotificationType: body.NotificationType,
+		TmdbId:           media.TmdbId,
+		TvdbId:           media.TvdbId,
+		Requester:        body.Username,
+		Subject:          body.Subject,
+		Message:          body.Message,
+		Image:            body.Image,
+		Seasons:          make([]int, 0),
+	}
+
+	// Overseerr only includes the 4k flag in custom templates, otherwise it's part of the event name
+	request.Is4k = strings.Contains(strings.ToUpper(body.Event), "4K")
+
+	if body.Request != nil {
+		request.RequestId = body.Request.RequestId
+		request.RequesterMail = body.Request.RequestedByEmail
+		request.Is4k = request.Is4k || bool(body.Request.Is4k)
+		if body.Request.RequestedByUser != "" {
+			request.Requester = body.Request.RequestedByUser
+		}
+	}
+
+	// Seasons are pulled out of extra, anything else is kept as is
+	unknown := make([]webhookExtra, 0)
+	for _, extra := range body.Extra {
+		if strings.EqualFold(extra.Name, extraRequestedSeasons) {
+			request.Seasons = db.ParseSeasons(extra.Value)
+			continue
+		}
+
+		unknown = append(unknown, extra)
+	}
+
+	if len(unknown) > 0 {
+		encoded, err := json.Marshal(unknown)
+		if err == nil {
+			request.Extra = string(encoded)
+		}
+	}
+
+	return request
+}
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(strings.TrimSpace(string(data)), `"`)
+	if value == "" || value == "null" {
+		*b = false
+		return nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", value)
+	}
+
+	*b = flexibleBool(parsed)
+
+	return nil
+}
+
+func closeRequestBody(body io.ReadCloser) {
+	err := body.Close()
+	if err != nil {
+		log.Printf("Error closing request body: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+
+	db "github.com/sjdaws/overtrakt/database"
+)
+
+func TestMatchStoredRequests(t *testing.T) {
+	stored := func(requester string, status string, is4k bool) *db.TraktRequest {
+		return &db.TraktRequest{ImdbId: "tt0903747", RequestType: "show", TvdbId: "81189", Requester: requester, RequestId: requester + "-request", Is4k: is4k, Status: status}
+	}
+
+	tests := []struct {
+		name    string
+		stored  []*db.TraktRequest
+		action  action
+		want    []string
+		wantArr bool
+	}{
+		{
+			name:    "nothing stored",
+			action:  actionAdd,
+			wantArr: true,
+		},
+		{
+			name:   "add applies to each requester",
+			stored: []*db.TraktRequest{stored("jesse", db.RequestStatusSynced, false), stored("walter", db.RequestStatusPending, false)},
+			action: actionAdd,
+			want:   []string{"jesse", "walter"},
+		},
+		{
+			name:   "add skips removed requests",
+			stored: []*db.TraktRequest{stored("jesse", db.RequestStatusRemoved, false), stored("walter", db.RequestStatusSynced, false)},
+			action: actionAdd,
+			want:   []string{"walter"},
+		},
+		{
+			name:   "add ignores media which has only been removed",
+			stored: []*db.TraktRequest{stored("jesse", db.RequestStatusRemoved, false)},
+			action: actionAdd,
+			want:   []string{},
+		},
+		{
+			name:   "remove applies to removed requests",
+			stored: []*db.TraktRequest{stored("jesse", db.RequestStatusRemoved, false), stored("walter", db.RequestStatusSynced, false)},
+			action: actionRemove,
+			want:   []string{"jesse", "walter"},
+		},
+		{
+			name:    "other quality is left alone",
+			stored:  []*db.TraktRequest{stored("jesse", db.RequestStatusSynced, true)},
+			action:  actionAdd,
+			wantArr: true,
+		},
+	}
+
+	for _, test := range tests {
+		request := &db.TraktRequest{ImdbId: "tt0903747", RequestType: "show", TmdbId: "1396", TvdbId: "81189", Seasons: []int{2}}
+
+		got := matchStoredRequests(request, test.stored, test.action)
+
+		if test.wantArr {
+			if len(got) != 1 || got[0] != request {
+				t.Errorf("%s: expected the request as is, got %v", test.name, got)
+			}
+			continue
+		}
+
+		if len(got) != len(test.want) {
+			t.Errorf("%s: expected %d request(s), got %d", test.name, len(test.want), len(got))
+			continue
+		}
+
+		for i, matched := range got {
+			if matched.Requester != test.want[i] || matched.RequestId != test.want[i]+"-request" {
+				t.Errorf("%s: expected request for %s, got %s (%s)", test.name, test.want[i], matched.Requester, matched.RequestId)
+			}
+
+			if matched.TmdbId != "" || len(matched.Seasons) != 1 {
+				t.Errorf("%s: expected stored ids and requested seasons, got %+v", test.name, matched)
+			}
+		}
+	}
+}